@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"github.com/mlaoji/ygo/controllers"
+	"github.com/mlaoji/ygo/models/gen"
+	"github.com/mlaoji/ygo/x"
+)
+
+//代码生成命令, 需要在项目中注册: x.AddCli(&cli.GenController{})
+//./run cli gen/model "table=user[&conf=db_master&hash=10&type=all|model|dao&force=1&root=/path/to/app]"
+//./run cli gen/rpc "service=message&methods=message/sendMessage,message/getMessage[&force=1&root=/path/to/app]"
+//重新生成时只覆盖 ygo:gen 标记之间的代码, force=1 时文件不包含标记也会备份后覆盖
+type GenController struct {
+	controllers.BaseController
+}
+
+func (this *GenController) getGenerator() *gen.Generator { // {{{
+	g := gen.NewGenerator(this.GetString("conf"), this.GetString("root"))
+	g.App = this.GetString("app")
+	g.Force = this.GetBool("force")
+
+	return g
+} // }}}
+
+func (this *GenController) ModelAction() { // {{{
+	table := this.GetString("table")
+	x.Interceptor("" != table, x.ERR_PARAMS, "table")
+
+	typ := this.GetString("type", "all")
+	hash := this.GetInt("hash")
+	g := this.getGenerator()
+
+	files := []string{}
+	if "all" == typ || "dao" == typ {
+		file, err := g.GenDao(table, hash)
+		x.Interceptor(nil == err, x.ERR_OTHER, err)
+		files = append(files, file)
+	}
+
+	if "all" == typ || "model" == typ {
+		//model 文件为业务代码, 已存在时跳过
+		file, err := g.GenModel(table, hash)
+		if gen.ErrFileExists != err {
+			x.Interceptor(nil == err, x.ERR_OTHER, err)
+			files = append(files, file)
+		}
+	}
+
+	this.Render(x.MAP{"files": files})
+} // }}}
+
+func (this *GenController) RpcAction() { // {{{
+	service := this.GetString("service")
+	x.Interceptor("" != service, x.ERR_PARAMS, "service")
+
+	methods := this.GetSlice("methods")
+	if 0 == len(methods) {
+		methods = []string{service + "/test"}
+	}
+
+	file, err := this.getGenerator().GenRpcModel(service, methods)
+	x.Interceptor(nil == err, x.ERR_OTHER, err)
+
+	this.Render(x.MAP{"files": []string{file}})
+} // }}}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"github.com/mlaoji/ygo/controllers"
+	"github.com/mlaoji/ygo/models/migrate"
+	"github.com/mlaoji/ygo/x"
+)
+
+//数据库迁移命令, 需要在项目中注册: x.AddCli(&cli.MigrateController{})
+//./run cli migrate/up ["conf=db_master&n=1"]
+//./run cli migrate/down ["conf=db_master&n=1"]
+//./run cli migrate/status ["conf=db_master"]
+//./run cli migrate/create "name=create_user[&conf=db_master]"
+//可选参数 path 指定sql迁移文件根目录, 默认使用配置 migrate_path
+type MigrateController struct {
+	controllers.BaseController
+}
+
+func (this *MigrateController) getMigrator() *migrate.Migrator { // {{{
+	path := this.GetString("path", x.Conf.Get("migrate_path"))
+	return migrate.NewMigrator(this.GetString("conf"), path)
+} // }}}
+
+func (this *MigrateController) UpAction() { // {{{
+	done, err := this.getMigrator().Up(this.GetInt("n"))
+	this.render(done, err)
+} // }}}
+
+func (this *MigrateController) DownAction() { // {{{
+	done, err := this.getMigrator().Down(this.GetInt("n", 1))
+	this.render(done, err)
+} // }}}
+
+func (this *MigrateController) StatusAction() { // {{{
+	status, err := this.getMigrator().Status()
+	x.Interceptor(nil == err, x.ERR_OTHER, err)
+
+	list := []x.MAP{}
+	for _, v := range status {
+		list = append(list, x.MAP{"version": v.Version, "name": v.Name, "applied": v.Applied, "applied_at": v.AppliedAt})
+	}
+
+	this.Render(list)
+} // }}}
+
+func (this *MigrateController) CreateAction() { // {{{
+	name := this.GetString("name")
+	x.Interceptor("" != name, x.ERR_PARAMS, "name")
+
+	files, err := this.getMigrator().Create(name)
+	x.Interceptor(nil == err, x.ERR_OTHER, err)
+
+	this.Render(files)
+} // }}}
+
+func (this *MigrateController) render(done []*migrate.Migration, err error) { // {{{
+	versions := []string{}
+	for _, m := range done {
+		versions = append(versions, m.Version+"_"+m.Name)
+	}
+
+	x.Interceptor(nil == err, x.ERR_OTHER, err, x.MAP{"done": versions})
+
+	this.Render(x.MAP{"done": versions})
+} // }}}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"github.com/mlaoji/ygo/controllers"
+	"github.com/mlaoji/ygo/models/outbox"
+	"github.com/mlaoji/ygo/x"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//事务发件箱命令, 需要在项目中注册: x.AddCli(&cli.OutboxController{})
+//./run cli outbox/relay ["conf=db_master&batch=100&interval=1000&max_attempts=10&once=1"]
+//./run cli outbox/retry ["conf=db_master&ids=1,2,3"]
+//Sink 需要在项目中通过 outbox.RegisterSink 注册
+type OutboxController struct {
+	controllers.BaseController
+}
+
+//持续发送待发送的消息, 收到 SIGINT/SIGTERM 后当前批次发送完成再退出; once=1 时只发送一批
+func (this *OutboxController) RelayAction() { // {{{
+	relay := outbox.NewRelay(this.GetString("conf"),
+		outbox.WithBatchSize(this.GetInt("batch")),
+		outbox.WithInterval(time.Duration(this.GetInt("interval"))*time.Millisecond),
+		outbox.WithMaxAttempts(this.GetInt("max_attempts")),
+	)
+
+	if this.GetBool("once") {
+		sent, failed, err := relay.RunOnce()
+		x.Interceptor(nil == err, x.ERR_OTHER, err)
+
+		this.Render(x.MAP{"sent": sent, "failed": failed})
+		return
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-ch
+		relay.Stop()
+	}()
+
+	relay.Run()
+	signal.Stop(ch)
+
+	this.Render()
+} // }}}
+
+//将失败的消息重新置为待发送
+func (this *OutboxController) RetryAction() { // {{{
+	ids := []interface{}{}
+	for _, id := range strings.Split(this.GetString("ids"), ",") {
+		if id = strings.TrimSpace(id); "" != id {
+			ids = append(ids, id)
+		}
+	}
+
+	this.Render(x.MAP{"affected": outbox.Retry(this.GetString("conf"), ids...)})
+} // }}}
@@ -0,0 +1,2 @@
+-- down 20220101120000: create_user
+drop table if exists user;
@@ -0,0 +1,6 @@
+-- up 20220101120000: create_user
+create table if not exists user (
+    uid int unsigned not null auto_increment primary key,
+    name varchar(64) not null default '',
+    created_at datetime not null
+) engine=InnoDB default charset=utf8mb4;
@@ -0,0 +1,2 @@
+-- down 20220102120000: create_outbox
+drop table if exists outbox;
@@ -0,0 +1,16 @@
+-- up 20220102120000: create_outbox
+CREATE TABLE `outbox` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `topic` varchar(128) NOT NULL DEFAULT '',
+  `msg_key` varchar(128) NOT NULL DEFAULT '' COMMENT '相同key的消息按顺序发送',
+  `payload` mediumtext,
+  `status` tinyint NOT NULL DEFAULT '0' COMMENT '0:待发送 1:已发送 2:失败',
+  `attempts` int NOT NULL DEFAULT '0',
+  `next_at` datetime NOT NULL COMMENT '下次发送时间',
+  `last_error` varchar(512) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL,
+  `sent_at` datetime DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_status_next` (`status`,`next_at`),
+  KEY `idx_key` (`msg_key`,`status`,`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"github.com/mlaoji/ygo/controllers"
+	ygocli "github.com/mlaoji/ygo/controllers/cli"
 	"github.com/mlaoji/ygo/x"
 	//"github.com/mlaoji/yqueue"
 	//  "demo/src/workers"
@@ -10,6 +11,16 @@ import (
 func init() {
 	//注册CLI方法 (Action 结尾)
 	x.AddCli(&TestCliController{})
+
+	//注册数据库迁移命令: ./run cli migrate/up
+	x.AddCli(&ygocli.MigrateController{})
+
+	//注册代码生成命令: ./tools/genModel -t user
+	x.AddCli(&ygocli.GenController{})
+
+	//注册事务发件箱命令: ./run cli outbox/relay
+	//Sink 示例: outbox.RegisterSink("user.created", &outbox.RedisListSink{Redis: "redis", Key: "queue:user"})
+	x.AddCli(&ygocli.OutboxController{})
 }
 
 type TestCliController struct {
@@ -5,6 +5,8 @@ package models
 import (
 	"demo/src/models/dao"
 	//"github.com/mlaoji/ygo/models/dao/tx"
+	//"github.com/mlaoji/ygo/models/outbox"
+	//"github.com/mlaoji/ygo/x"
 )
 
 func User() *UserModel {
@@ -31,6 +33,9 @@ func (this *UserModel) AddUser() { // {{{
 			"info": "xxxx",
 		})
 
+		//与业务数据在同一事务中写入待发送的事件, 由 ./run cli outbox/relay 投递
+		outbox.Publish(tx, "user.created", x.ToString(uid), map[string]interface{}{"uid": uid})
+
 		tx.Commit()
 
 	*/
@@ -0,0 +1,124 @@
+package dao
+
+import (
+	"fmt"
+	"github.com/mlaoji/ygo/x"
+	"strings"
+)
+
+//审计日志配置
+//写入审计表时, 表结构如下:
+//CREATE TABLE `audit_log` (
+//  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+//  `table_name` varchar(64) NOT NULL DEFAULT '',
+//  `record_id` varchar(64) NOT NULL DEFAULT '',
+//  `action` varchar(16) NOT NULL DEFAULT '',
+//  `diff` text,
+//  `old_data` text,
+//  `created_at` datetime NOT NULL,
+//  PRIMARY KEY (`id`),
+//  KEY `idx_record` (`table_name`,`record_id`)
+//) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+type AuditConfig struct {
+	Table string //审计表名, 为空则写入日志文件
+	DB    string //审计表所在的db配置名, 默认 db_master
+	Log   string //日志名, 默认 audit, 即 audit.log
+}
+
+//开启审计: 预读变更前的记录, 事务提交后将变更写入审计表或日志, 在 DAO 的 Init 方法中调用
+//如: this.SetAudit(&dao.AuditConfig{Table: "audit_log"})
+func (this *DAOProxy) SetAudit(conf *AuditConfig) *DAOProxy { // {{{
+	return this.SetPreRead(true).AfterWrite(AuditHook(conf))
+} // }}}
+
+//内置审计钩子, 也可通过 dao.AfterWrite(dao.AuditHook(conf)) 全局注册(需在各 DAO 中开启 SetPreRead 才有变更前的值)
+func AuditHook(conf *AuditConfig) HookFunc { // {{{
+	if nil == conf {
+		conf = &AuditConfig{}
+	}
+
+	db_conf := conf.DB
+	if "" == db_conf {
+		db_conf = "db_master"
+	}
+
+	log_name := conf.Log
+	if "" == log_name {
+		log_name = "audit"
+	}
+
+	return func(e *ChangeEvent) {
+		if e.Table == conf.Table {
+			return
+		}
+
+		diff := Diff(e.Old, e.New)
+		if ACTION_UPDATE == e.Action && nil != e.Old && 0 == len(diff) {
+			return
+		}
+
+		record_id := ""
+		if nil != e.Id {
+			record_id = fmt.Sprint(e.Id)
+		}
+
+		if "" == conf.Table {
+			x.Logger.Other(log_name, map[string]interface{}{
+				"table":  e.Table,
+				"id":     record_id,
+				"action": e.Action,
+				"where":  e.Where,
+				"diff":   diff,
+			})
+
+			return
+		}
+
+		old_data := ""
+		if nil != e.Old {
+			old_data = x.JsonEncode(e.Old)
+		}
+
+		x.DB.Get(db_conf).Insert(conf.Table, map[string]interface{}{
+			"table_name": e.Table,
+			"record_id":  record_id,
+			"action":     e.Action,
+			"diff":       x.JsonEncode(diff),
+			"old_data":   old_data,
+			"created_at": x.DateTime(),
+		})
+	}
+} // }}}
+
+//比较新旧值, 返回 字段 => [旧值, 新值], 新增时旧值为nil, 删除时新值为nil
+//新旧值使用字符串比较(读出的值均为字符串); 通过 db.DBFuncParam 设置的值不参与比较
+func Diff(old, data map[string]interface{}) map[string][]interface{} { // {{{
+	diff := map[string][]interface{}{}
+
+	if nil == data {
+		for k, v := range old {
+			diff[k] = []interface{}{v, nil}
+		}
+
+		return diff
+	}
+
+	for k, v := range data {
+		nv := fmt.Sprint(v)
+		if strings.HasPrefix(nv, "#:F:#") {
+			continue
+		}
+
+		if nil == old {
+			diff[k] = []interface{}{nil, v}
+			continue
+		}
+
+		ov, ok := old[k]
+		if !ok || fmt.Sprint(ov) != nv {
+			diff[k] = []interface{}{ov, v}
+		}
+	}
+
+	return diff
+} // }}}
@@ -0,0 +1,218 @@
+package dao
+
+import (
+	"fmt"
+	"github.com/mlaoji/ygo/x"
+	"github.com/mlaoji/ygo/x/db"
+	"strings"
+)
+
+//乐观锁冲突, SetRecord 时版本号已变化(或记录不存在), 以 panic 形式抛出
+type VersionConflictError struct {
+	Table   string
+	Id      interface{}
+	Version interface{}
+}
+
+func (this *VersionConflictError) Error() string {
+	return fmt.Sprintf("version conflict: table[%s] id[%v] version[%v]", this.Table, this.Id, this.Version)
+}
+
+//DAO 可选行为, 在 DAO 的 Init 方法中设置
+type behavior struct {
+	createdField string //创建时间字段
+	updatedField string //更新时间字段
+	unixTime     bool   //时间字段是否为unix时间戳
+
+	softDelete   string      //软删除标记字段
+	deletedVal   interface{} //已删除时的值
+	undeletedVal interface{} //未删除时的值
+	withDeleted  bool        //读取时包含已删除记录, 只能通过WithDeleted使用一次
+	forceDelete  bool        //物理删除, 只能通过ForceDelete使用一次
+
+	versionField string //乐观锁版本号字段
+}
+
+//自动填充创建及更新时间, 字段名为空则不填充, unix 为true时填充unix时间戳, 否则填充 x.DateTime() 格式
+//新增时未传入(或为零值)的时间字段自动填充, 更新时总是刷新更新时间
+//如: this.SetTimestamps("created_at", "updated_at")
+func (this *DAOProxy) SetTimestamps(created, updated string, unix ...bool) *DAOProxy { // {{{
+	this.behavior.createdField = created
+	this.behavior.updatedField = updated
+	this.behavior.unixTime = len(unix) > 0 && unix[0]
+	return this
+} // }}}
+
+//开启软删除, DelRecord 等方法将 field 更新为已删除值(默认1), 读取方法自动排除已删除记录(未删除值默认0)
+//如: this.SetSoftDelete("is_deleted") 或 this.SetSoftDelete("status", -1, 1)
+func (this *DAOProxy) SetSoftDelete(field string, vals ...interface{}) *DAOProxy { // {{{
+	this.behavior.softDelete = field
+	this.behavior.deletedVal = 1
+	this.behavior.undeletedVal = 0
+
+	if len(vals) > 0 {
+		this.behavior.deletedVal = vals[0]
+	}
+
+	if len(vals) > 1 {
+		this.behavior.undeletedVal = vals[1]
+	}
+
+	return this
+} // }}}
+
+//开启乐观锁, SetRecord 时若传入的值中包含版本号字段, 则只在版本号未变化时更新, 否则抛出 *VersionConflictError
+//每次 SetRecord/SetRecordBy 版本号自动加1
+func (this *DAOProxy) SetVersionField(field string) *DAOProxy { // {{{
+	this.behavior.versionField = field
+	return this
+} // }}}
+
+//可在读方法前使用，且仅对本次查询起作用，读取时包含已软删除的记录
+func (this *DAOProxy) WithDeleted() *DAOProxy { // {{{
+	this.behavior.withDeleted = true
+	return this
+} // }}}
+
+//可在删除方法前使用，且仅对本次删除起作用，忽略软删除设置, 物理删除记录
+func (this *DAOProxy) ForceDelete() *DAOProxy { // {{{
+	this.behavior.forceDelete = true
+	return this
+} // }}}
+
+//恢复软删除的记录, 同时刷新更新时间
+func (this *DAOProxy) RestoreRecord(id interface{}) int { // {{{
+	if "" == this.behavior.softDelete {
+		return 0
+	}
+
+	data := this.fillTimestamps(map[string]interface{}{this.behavior.softDelete: this.behavior.undeletedVal}, false)
+
+	defer this.DelCache(id)
+	return this.change(ACTION_RESTORE, id, "", nil, data, func(data map[string]interface{}) int {
+		return this.DBWriter.Update(this.table, data, this.primary+"=?", id)
+	})
+} // }}}
+
+//读取条件中加入软删除过滤
+func (this *DAOProxy) scopeWhere(where string, values []interface{}) (string, []interface{}) { // {{{
+	with_deleted := this.behavior.withDeleted
+	this.behavior.withDeleted = false
+
+	if "" == this.behavior.softDelete || with_deleted {
+		return where, values
+	}
+
+	cond := "`" + this.behavior.softDelete + "`=?"
+	if "" != strings.TrimSpace(where) {
+		cond = "(" + where + ") and " + cond
+	}
+
+	return cond, append(append([]interface{}{}, values...), this.behavior.undeletedVal)
+} // }}}
+
+//删除: 开启软删除时更新删除标记, 否则物理删除
+func (this *DAOProxy) delete(where string, values []interface{}, limit string) int { // {{{
+	force := this.behavior.forceDelete
+	this.behavior.forceDelete = false
+
+	if "" == this.behavior.softDelete || force {
+		return this.DBWriter.Execute("delete from "+this.table+" where "+where+limit, values...)
+	}
+
+	vals := map[string]interface{}{this.behavior.softDelete: this.behavior.deletedVal}
+	if "" != this.behavior.updatedField {
+		vals[this.behavior.updatedField] = this.now()
+	}
+
+	return this.DBWriter.Update(this.table, vals, where+limit, values...)
+} // }}}
+
+//填充时间字段, 返回新的map(不修改传入的map)
+func (this *DAOProxy) fillTimestamps(data map[string]interface{}, is_create bool) map[string]interface{} { // {{{
+	created, updated := this.behavior.createdField, this.behavior.updatedField
+	if !is_create {
+		created = ""
+	}
+
+	if "" == created && "" == updated {
+		return data
+	}
+
+	ret := make(map[string]interface{}, len(data)+2)
+	for k, v := range data {
+		ret[k] = v
+	}
+
+	now := this.now()
+	if "" != created && isEmptyTime(ret[created]) {
+		ret[created] = now
+	}
+
+	if "" != updated && (!is_create || isEmptyTime(ret[updated])) {
+		ret[updated] = now
+	}
+
+	return ret
+} // }}}
+
+func (this *DAOProxy) now() interface{} { // {{{
+	if this.behavior.unixTime {
+		return x.Now()
+	}
+
+	return x.DateTime()
+} // }}}
+
+//更新时写入的值: 填充更新时间, 开启乐观锁时版本号改为自增, 返回新的map及传入的版本号(check 为是否传入)
+//在触发钩子前调用, 使钩子中可以看到这些字段
+func (this *DAOProxy) updateValues(data map[string]interface{}) (vals map[string]interface{}, cur interface{}, check bool) { // {{{
+	data = this.fillTimestamps(data, false)
+
+	version := this.behavior.versionField
+	if "" == version {
+		return data, nil, false
+	}
+
+	cur, check = data[version]
+
+	vals = make(map[string]interface{}, len(data))
+	for k, v := range data {
+		vals[k] = v
+	}
+	//以空格开头, 拼入sql时无论是否去掉标记后的第一个字符都有效
+	vals[version] = db.DBFuncParam(" `" + version + "`+1")
+
+	return vals, cur, check
+} // }}}
+
+//更新, check 为true时只在版本号等于 cur 时更新, 否则抛出 *VersionConflictError
+func (this *DAOProxy) update(data map[string]interface{}, where string, params []interface{}, id interface{}, cur interface{}, check bool) int { // {{{
+	if check {
+		where = "(" + where + ") and `" + this.behavior.versionField + "`=?"
+		params = append(append([]interface{}{}, params...), cur)
+	}
+
+	affected := this.DBWriter.Update(this.table, data, where, params...)
+	if check && 0 == affected {
+		panic(&VersionConflictError{Table: this.table, Id: id, Version: cur})
+	}
+
+	return affected
+} // }}}
+
+//时间字段是否需要自动填充
+func isEmptyTime(v interface{}) bool { // {{{
+	switch val := v.(type) {
+	case nil:
+		return true
+	case string:
+		return "" == val || strings.HasPrefix(val, "0000-00-00") || strings.HasPrefix(val, "0001-01-01")
+	case int:
+		return 0 == val
+	case int64:
+		return 0 == val
+	}
+
+	return false
+} // }}}
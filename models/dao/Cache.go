@@ -0,0 +1,202 @@
+package dao
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mlaoji/ygo/x"
+	"github.com/mlaoji/ygo/x/cache"
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	//缓存key前缀
+	CacheKeyPrefix = "ygo:dao:"
+
+	//合并并发的缓存未命中
+	cacheGroup = &cache.Group{}
+
+	//缓存key(按hash分组)的版本号, 删除缓存时递增, 加载期间版本号变化则不写入缓存, 避免写入删除前读出的旧记录
+	cacheGens [256]uint64
+)
+
+//记录不存在时的缓存值
+const cacheMissing = "{}"
+
+//按主键缓存记录(GetRecord), 在 DAO 的 Init 方法中通过 SetCache 开启
+type CacheConfig struct {
+	TTL         time.Duration //缓存时间
+	NegativeTTL time.Duration //记录不存在时的缓存时间, 0 则不缓存
+	Local       bool          //使用 x.LocalCache, 开启了广播时(redis_localcache)同时通知其他进程删除
+	Redis       string        //redis 配置名, 为空则不使用
+}
+
+//开启主键记录缓存, 如: this.SetCache(&dao.CacheConfig{TTL: time.Minute, Local: true})
+//缓存未命中时从主库读取记录; SetRecord/DelRecord/ResetRecord 等写方法会自动删除相关缓存
+//注意: SetRecordBy/DelRecordBy/DelRecords 按条件写入前会先从主库查出受影响记录的主键, 每次写入多一次查询
+func (this *DAOProxy) SetCache(conf *CacheConfig) *DAOProxy { // {{{
+	this.cache = conf
+	return this
+} // }}}
+
+func (this *DAOProxy) cacheKey(id interface{}) string { // {{{
+	return CacheKeyPrefix + this.DBWriter.ID() + ":" + this.table + ":" + fmt.Sprint(id)
+} // }}}
+
+//从缓存中读取记录, 未命中时调用load并写入缓存, 并发的未命中只调用一次load
+func (this *DAOProxy) cachedRecord(id interface{}, load func() map[string]interface{}) map[string]interface{} { // {{{
+	key := this.cacheKey(id)
+
+	if row, found := this.getCache(key); found {
+		return row
+	}
+
+	v, _, _ := cacheGroup.Do(key, func() (interface{}, error) {
+		if row, found := this.getCache(key); found {
+			return row, nil
+		}
+
+		gen := cacheGen(key)
+		ver := atomic.LoadUint64(gen)
+
+		row := load()
+		if atomic.LoadUint64(gen) == ver {
+			this.setCache(key, row)
+		}
+		return row, nil
+	})
+
+	return copyRow(v.(map[string]interface{}))
+} // }}}
+
+func (this *DAOProxy) getCache(key string) (map[string]interface{}, bool) { // {{{
+	if this.cache.Local && nil != x.LocalCache {
+		if v, found := x.LocalCache.Get(key); found {
+			return copyRow(v.(map[string]interface{})), true
+		}
+	}
+
+	if "" != this.cache.Redis {
+		if rds, err := x.NewRedis(this.cache.Redis); nil == err {
+			str, err := rds.Get(key)
+			if nil == err && "" != str {
+				row := map[string]interface{}{}
+				if cacheMissing != str {
+					if err = json.Unmarshal([]byte(str), &row); err != nil {
+						return nil, false
+					}
+				}
+
+				if this.cache.Local && nil != x.LocalCache {
+					x.LocalCache.Set(key, row, this.ttl(row))
+				}
+
+				return copyRow(row), true
+			}
+		}
+	}
+
+	return nil, false
+} // }}}
+
+func (this *DAOProxy) setCache(key string, row map[string]interface{}) { // {{{
+	ttl := this.ttl(row)
+	if ttl <= 0 {
+		return
+	}
+
+	if this.cache.Local && nil != x.LocalCache {
+		x.LocalCache.Set(key, copyRow(row), ttl)
+	}
+
+	if "" != this.cache.Redis {
+		if rds, err := x.NewRedis(this.cache.Redis); nil == err {
+			val := cacheMissing
+			if len(row) > 0 {
+				val = x.JsonEncode(row)
+			}
+
+			secs := int(ttl / time.Second)
+			if secs < 1 {
+				secs = 1
+			}
+
+			rds.Setex(key, secs, val)
+		}
+	}
+} // }}}
+
+//删除主键记录缓存, 在事务中时于事务提交后删除(回滚则不删除), 避免提交前其他请求将旧记录重新写入缓存
+func (this *DAOProxy) DelCache(ids ...interface{}) { // {{{
+	if nil == this.cache || 0 == len(ids) {
+		return
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = this.cacheKey(id)
+	}
+
+	if this.intx {
+		this.DBWriter.AfterCommit(func() {
+			this.delCache(keys)
+		})
+		return
+	}
+
+	this.delCache(keys)
+} // }}}
+
+func (this *DAOProxy) delCache(keys []string) { // {{{
+	for _, key := range keys {
+		atomic.AddUint64(cacheGen(key), 1)
+		cacheGroup.Forget(key)
+
+		if this.cache.Local && nil != x.LocalCache {
+			if err := x.LocalCache.Invalidate(key); nil != err {
+				x.Logger.Warn("dao cache broadcast error:", key, err)
+			}
+		}
+
+		if "" != this.cache.Redis {
+			if rds, err := x.NewRedis(this.cache.Redis); nil == err {
+				rds.Del(key)
+			}
+		}
+	}
+} // }}}
+
+//按条件写入前, 从主库查出受影响记录的主键, 用于删除缓存; 仅开启缓存时执行
+func (this *DAOProxy) cachedIds(where string, values []interface{}) []interface{} { // {{{
+	if nil == this.cache {
+		return nil
+	}
+
+	list := this.DBWriter.GetAll("select "+this.primary+" from "+this.table+" where "+where, values...)
+	return x.ArrayColumn(list, this.primary).([]interface{})
+} // }}}
+
+func (this *DAOProxy) ttl(row map[string]interface{}) time.Duration { // {{{
+	if 0 == len(row) {
+		return this.cache.NegativeTTL
+	}
+
+	return this.cache.TTL
+} // }}}
+
+func cacheGen(key string) *uint64 { // {{{
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	return &cacheGens[h.Sum32()%uint32(len(cacheGens))]
+} // }}}
+
+func copyRow(row map[string]interface{}) map[string]interface{} { // {{{
+	ret := make(map[string]interface{}, len(row))
+	for k, v := range row {
+		ret[k] = v
+	}
+
+	return ret
+} // }}}
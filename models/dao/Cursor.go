@@ -0,0 +1,256 @@
+package dao
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/mlaoji/ygo/x"
+	"reflect"
+	"strings"
+)
+
+//游标中保存的排序信息
+type cursorToken struct {
+	Order  string        `json:"o"` //排序, 用于校验游标是否属于当前查询
+	Values []interface{} `json:"v"` //上一页最后一条记录的排序字段值
+}
+
+type orderColumn struct {
+	expr string //sql中的字段, 如: `id`, u.id
+	name string //结果中的字段名
+	desc bool
+}
+
+//基于游标(keyset)的分页, 不需要统计总数, 也不会因offset过大而变慢, 适用于大表及"加载更多"
+//排序使用 Order 设置(默认按主键倒序), 排序字段中不包含主键时自动追加主键以保证顺序唯一, 排序字段不能为NULL
+//cursor 为上一次返回的游标, 第一页传空字符串, 游标无效(或与当前排序不符)时抛出参数错误(x.ERR_PARAMS); 返回的游标为空字符串时表示没有更多记录
+//如: list, next := NewDAOUser().Order("created_at desc").GetPage(cursor, 20, "status=?", 1)
+func (this *DAOProxy) GetPage(cursor string, size int, params ...interface{}) ([]map[string]interface{}, string) { //{{{
+	order := this.getOrder()
+	if "" == order {
+		order = this.GetPrimary()
+	}
+
+	cols := this.parseOrder(order)
+	order = ""
+	for i, col := range cols {
+		if i > 0 {
+			order += ","
+		}
+
+		order += col.expr
+		if col.desc {
+			order += " desc"
+		}
+	}
+
+	where, values := this.scopeWhere(this.parseParams(params...))
+
+	if "" != cursor {
+		token := decodeCursor(cursor)
+		//游标由客户端传入, 无效时按参数错误处理
+		x.Interceptor(nil != token && token.Order == order && len(token.Values) == len(cols), x.ERR_PARAMS, "cursor")
+
+		cond, vals := keysetWhere(cols, token.Values)
+		if "" != strings.TrimSpace(where) {
+			cond = "(" + where + ") and " + cond
+		}
+
+		where = cond
+		values = append(append([]interface{}{}, values...), vals...)
+	}
+
+	if "" != where {
+		where = " where " + where
+	}
+
+	fidx := ""
+	idx := this.getIndex()
+	if "" != idx {
+		fidx = " force key(" + idx + ") "
+	}
+
+	if size <= 0 {
+		size = 20
+	}
+
+	this.limit = ""
+	list := this.recordReader().GetAll("select "+cursorFields(this.GetFields(), cols)+" from "+this.table+fidx+where+" order by "+order+" limit "+x.ToString(size+1), values...)
+
+	has_next := len(list) > size
+	if has_next {
+		list = list[:size]
+	}
+
+	if len(list) > 0 && nil != this.bind {
+		this.parseRecords(list)
+	}
+
+	next := ""
+	if has_next {
+		last := list[size-1]
+
+		token := &cursorToken{Order: order, Values: make([]interface{}, len(cols))}
+		for i, col := range cols {
+			token.Values[i] = last[col.name]
+		}
+
+		next = encodeCursor(token)
+	}
+
+	return list, next
+} // }}}
+
+//逐条读取记录, 不会一次将全部结果读入内存, 适用于导出及批处理, fn 返回false时停止, 返回已读取的记录数
+//支持 SetFields/Order/Limit/UseIndex 及软删除过滤; 使用Bind绑定struct指针时, 每条记录会先填充到该struct
+//如: NewDAOUser().Each(func(row map[string]interface{}) bool { ...; return true }, "status=?", 1)
+func (this *DAOProxy) Each(fn func(row map[string]interface{}) bool, params ...interface{}) int { //{{{
+	where, values := this.scopeWhere(this.parseParams(params...))
+
+	if "" != where {
+		where = " where " + where
+	}
+
+	fidx := ""
+	idx := this.getIndex()
+	if "" != idx {
+		fidx = " force key(" + idx + ") "
+	}
+
+	order := this.getOrder()
+	if "" != order {
+		where = where + " order by " + order
+	}
+
+	limit := this.getLimit()
+	if "" != limit {
+		where = where + " limit " + limit
+	}
+
+	fill := nil != this.bind && reflect.Indirect(reflect.ValueOf(this.bind)).Kind() == reflect.Struct
+
+	reader := this.GetDBReader()
+	if fill {
+		reader = reader.WithNull()
+	}
+
+	return reader.Each("select "+this.GetFields()+" from "+this.table+fidx+where, func(row map[string]interface{}) bool {
+		if fill {
+			this.parseRecord(row)
+		}
+
+		return fn(row)
+	}, values...)
+} // }}}
+
+//解析排序, 如: "created_at desc, `id`"
+func (this *DAOProxy) parseOrder(order string) []*orderColumn { //{{{
+	cols := []*orderColumn{}
+	has_primary := false
+	for _, item := range strings.Split(order, ",") {
+		parts := strings.Fields(item)
+		if 0 == len(parts) {
+			continue
+		}
+
+		col := &orderColumn{expr: parts[0], name: columnName(parts[0])}
+		if len(parts) > 1 && "desc" == strings.ToLower(parts[1]) {
+			col.desc = true
+		}
+
+		if col.name == this.GetPrimary() {
+			has_primary = true
+		}
+
+		cols = append(cols, col)
+	}
+
+	if !has_primary {
+		col := &orderColumn{expr: this.GetPrimary(), name: this.GetPrimary()}
+		if len(cols) > 0 {
+			col.desc = cols[len(cols)-1].desc
+		}
+
+		cols = append(cols, col)
+	}
+
+	return cols
+} // }}}
+
+//生成游标条件, 如排序 a desc, id desc: (a<?) or (a=? and id<?)
+func keysetWhere(cols []*orderColumn, vals []interface{}) (string, []interface{}) { //{{{
+	conds := []string{}
+	values := []interface{}{}
+
+	for i, col := range cols {
+		cond := ""
+		for j := 0; j < i; j++ {
+			cond += cols[j].expr + "=? and "
+			values = append(values, vals[j])
+		}
+
+		if col.desc {
+			cond += col.expr + "<?"
+		} else {
+			cond += col.expr + ">?"
+		}
+		values = append(values, vals[i])
+
+		conds = append(conds, "("+cond+")")
+	}
+
+	return "(" + strings.Join(conds, " or ") + ")", values
+} // }}}
+
+//确保查询字段中包含排序字段
+func cursorFields(fields string, cols []*orderColumn) string { //{{{
+	exists := map[string]bool{}
+	for _, f := range strings.Split(fields, ",") {
+		parts := strings.Fields(f)
+		if 0 == len(parts) {
+			continue
+		}
+
+		name := columnName(parts[len(parts)-1])
+		if "*" == name {
+			return fields
+		}
+
+		exists[name] = true
+	}
+
+	for _, col := range cols {
+		if !exists[col.name] {
+			fields += "," + col.expr
+			exists[col.name] = true
+		}
+	}
+
+	return fields
+} // }}}
+
+//去掉表名及反引号, 如: u.`id` => id
+func columnName(expr string) string { //{{{
+	if idx := strings.LastIndex(expr, "."); idx >= 0 {
+		expr = expr[idx+1:]
+	}
+
+	return strings.Trim(expr, "`")
+} // }}}
+
+func encodeCursor(token *cursorToken) string { //{{{
+	return base64.RawURLEncoding.EncodeToString(x.JsonEncodeBytes(token))
+} // }}}
+
+func decodeCursor(cursor string) *cursorToken { //{{{
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil
+	}
+
+	token := &cursorToken{}
+	if err = json.Unmarshal(b, token); err != nil {
+		return nil
+	}
+
+	return token
+} // }}}
@@ -2,6 +2,7 @@ package dao
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/mlaoji/ygo/x"
 	"github.com/mlaoji/ygo/x/db"
@@ -26,6 +27,13 @@ type DAOProxy struct {
 	order              string
 	forceMaster        bool //强制使用主库读，只能通过useMaster 使用一次
 	bind               interface{}
+	bindFields         bool         //fields 是否由Bind设置
+	behavior           behavior     //自动时间、软删除、乐观锁等可选行为
+	cache              *CacheConfig //主键记录缓存配置
+	intx               bool         //是否使用事务
+	beforeHooks        []HookFunc   //写入前钩子
+	afterHooks         []HookFunc   //写入后钩子
+	preRead            bool         //写入前预读受影响的记录
 }
 
 func (this *DAOProxy) Init(conf ...string) { //{{{
@@ -41,7 +49,11 @@ func (this *DAOProxy) Init(conf ...string) { //{{{
 		slave_conf = conf[1]
 	}
 
-	slave_confs := x.Conf.GetNode(slave_conf)
+	var slave_confs x.YamlNode
+	if nil != x.Conf { //单元测试中可能没有加载配置, 见 x.DB.Set
+		slave_confs = x.Conf.GetNode(slave_conf)
+	}
+
 	if nil == slave_confs {
 		slave_conf = master_conf
 	} else if slave_list, ok := slave_confs.(yaml.YamlList); ok {
@@ -59,10 +71,32 @@ func (this *DAOProxy) Init(conf ...string) { //{{{
 func (this *DAOProxy) InitTx(tx db.DBClient) { //使用事务{{{
 	this.defaultFields = "*"
 	this.autoOrder = true
+	this.intx = true
 	this.DBWriter = tx
 	this.DBReader = tx
 } // }}}
 
+//为读写连接设置请求id, 用于慢查询日志追踪, 如: NewDAOUser().WithRequestId(rid).GetRecord(uid)
+func (this *DAOProxy) WithRequestId(request_id string) *DAOProxy { // {{{
+	this.DBWriter = this.DBWriter.WithRequestId(request_id)
+	this.DBReader = this.DBReader.WithRequestId(request_id)
+	return this
+} // }}}
+
+//为读写连接设置context, context 取消或超时时中止查询, 如: NewDAOUser().WithContext(ctx).GetRecord(uid)
+func (this *DAOProxy) WithContext(ctx context.Context) *DAOProxy { // {{{
+	this.DBWriter = this.DBWriter.WithContext(ctx)
+	this.DBReader = this.DBReader.WithContext(ctx)
+	return this
+} // }}}
+
+//为读写连接设置查询超时时间, 如: NewDAOUser().WithTimeout(time.Second).GetList(...)
+func (this *DAOProxy) WithTimeout(timeout time.Duration) *DAOProxy { // {{{
+	this.DBWriter = this.DBWriter.WithTimeout(timeout)
+	this.DBReader = this.DBReader.WithTimeout(timeout)
+	return this
+} // }}}
+
 func (this *DAOProxy) SetTable(table string) {
 	this.table = table
 }
@@ -111,6 +145,7 @@ func (this *DAOProxy) GetFields() string { // {{{
 		fields = this.fields
 		this.fields = ""
 	}
+	this.bindFields = false
 
 	return fields
 } // }}}
@@ -191,6 +226,15 @@ func (this *DAOProxy) GetDBReader() db.DBClient { // {{{
 	return this.DBReader
 } // }}}
 
+//读取记录使用的连接, Bind 时保留 NULL 以便指针字段及 sql.Scanner 区分 NULL, 填充后再转为空字符串
+func (this *DAOProxy) recordReader() db.DBClient { // {{{
+	if nil != this.bind {
+		return this.GetDBReader().WithNull()
+	}
+
+	return this.GetDBReader()
+} // }}}
+
 //必须为指针 单条记录指向 struct , 多条记录指向[]struct 或 []*struct
 //使用: NewDAOUser().bind([]struct).GetRecords(...
 func (this *DAOProxy) Bind(objPtr interface{}) *DAOProxy { // {{{
@@ -205,7 +249,6 @@ func (this *DAOProxy) Bind(objPtr interface{}) *DAOProxy { // {{{
 
 func (this *DAOProxy) parseFields(objPtr interface{}) { //{{{
 	objVal := reflect.Indirect(reflect.ValueOf(objPtr))
-	data := map[string]interface{}{}
 	var valPtr interface{}
 
 	if objVal.Kind() == reflect.Slice {
@@ -228,23 +271,22 @@ func (this *DAOProxy) parseFields(objPtr interface{}) { //{{{
 		panic("needs a pointer to a slice or a struct")
 	}
 
-	data = this.preParams(valPtr)
 	buf := bytes.NewBufferString("")
-	i := 0
-	for k, _ := range data {
+	for i, fi := range structFields(reflect.Indirect(reflect.ValueOf(valPtr)).Type()) {
 		if i > 0 {
 			buf.WriteString(",")
 		}
 
-		buf.WriteString(k)
-		i++
+		buf.WriteString(fi.name)
 	}
 
 	this.fields = buf.String()
+	this.bindFields = true
 } // }}}
 
 func (this *DAOProxy) parseRecord(data map[string]interface{}) { //{{{
 	this.Fillin(this.bind, data)
+	emptyNull(data)
 } // }}}
 
 func (this *DAOProxy) parseRecords(data []map[string]interface{}) { //{{{
@@ -271,73 +313,32 @@ func (this *DAOProxy) parseRecords(data []map[string]interface{}) { //{{{
 			this.Fillin(newValue.Interface(), v)
 			sliceValue.Set(reflect.Append(sliceValue, reflect.Indirect(reflect.ValueOf(newValue.Interface()))))
 		}
+		emptyNull(v)
 	}
 } // }}}
 
 //map to struct
+//支持基本类型、time.Time、[]byte、指针(NULL)、sql.Scanner、匿名struct 及 json tag, 见 fieldInfo
 func (this *DAOProxy) Fillin(obj interface{}, data map[string]interface{}) { // {{{
 	dataStruct := reflect.Indirect(reflect.ValueOf(obj))
-	typ := dataStruct.Type()
 
-	numField := typ.NumField()
-	for i := 0; i < numField; i++ {
-		typField := typ.Field(i)
-		valField := dataStruct.Field(i)
-
-		if !valField.CanSet() {
-			continue
-		}
-
-		tag := typField.Tag.Get("db")
-		if tag == "-" || tag == "nil" {
+	for _, fi := range structFields(dataStruct.Type()) {
+		value, ok := data[fi.name]
+		if !ok {
 			continue
 		}
 
-		if tag == "" {
-			tag = strings.ToLower(typField.Name)
-		}
-
-		value, ok := data[tag]
-		if !ok {
+		valField := fieldByIndex(dataStruct, fi.index, true)
+		if !valField.IsValid() || !valField.CanSet() {
 			continue
 		}
 
-		kind := typField.Type.Kind()
-
-		switch kind {
-		case reflect.Bool:
-			b, err := strconv.ParseBool(value.(string))
-			if err != nil {
-				panic(err)
-			}
-			valField.SetBool(b)
-		case reflect.String:
-			valField.SetString(value.(string))
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			i, err := strconv.ParseInt(value.(string), 0, 64)
-			if err != nil {
-				panic(err)
-			}
-			valField.SetInt(i)
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			u, err := strconv.ParseUint(value.(string), 0, 64)
-			if err != nil {
-				panic(err)
-			}
-			valField.SetUint(u)
-		case reflect.Float32, reflect.Float64:
-			f, err := strconv.ParseFloat(value.(string), 64)
-			if err != nil {
-				panic(err)
-			}
-			valField.SetFloat(f)
-		default:
-			panic(fmt.Sprintf("unsupported type: %s", kind.String()))
-		}
+		setField(valField, fi, value)
 	}
 } // }}}
 
 //struct2Map
+//nil指针写入NULL, 实现了driver.Valuer的字段使用Value()的返回值, tag 指定omitempty时忽略零值
 func (this *DAOProxy) preParams(obj interface{}) map[string]interface{} { //{{{
 	if p, ok := obj.(map[string]interface{}); ok {
 		return p
@@ -353,21 +354,12 @@ func (this *DAOProxy) preParams(obj interface{}) map[string]interface{} { //{{{
 		panic("need a [map or Struct ] or a pointer to [map or Struct ]")
 	}
 
-	t := objVal.Type()
-
 	var data = make(map[string]interface{})
 
-	for i := 0; i < t.NumField(); i++ {
-		tag := t.Field(i).Tag.Get("db")
-		if tag == "-" || tag == "nil" {
-			continue
+	for _, fi := range structFields(objVal.Type()) {
+		if param, skip := fieldParam(fieldByIndex(objVal, fi.index, false), fi); !skip {
+			data[fi.name] = param
 		}
-
-		if tag == "" {
-			tag = strings.ToLower(t.Field(i).Name)
-		}
-
-		data[tag] = objVal.Field(i).Interface()
 	}
 
 	return data
@@ -441,7 +433,7 @@ func (this *DAOProxy) Execute(sql string, params ...interface{}) int { //{{{
 
 //复杂查询
 func (this *DAOProxy) Query(sql string, params ...interface{}) []map[string]interface{} { //{{{
-	list := this.GetDBReader().GetAll(sql, params...)
+	list := this.recordReader().GetAll(sql, params...)
 
 	if len(list) > 0 && nil != this.bind {
 		this.parseRecords(list)
@@ -451,50 +443,111 @@ func (this *DAOProxy) Query(sql string, params ...interface{}) []map[string]inte
 } // }}}
 
 //AddRecord、SetRecord、ResetRecord 支持传入map[string]interface{} 和 struct 两种类型参数
+//开启乐观锁时, 版本号冲突会抛出 *VersionConflictError
 func (this *DAOProxy) AddRecord(vals interface{}) int { //{{{
-	return this.DBWriter.Insert(this.table, this.preParams(vals))
+	id := this.change(ACTION_INSERT, nil, "", nil, this.fillTimestamps(this.preParams(vals), true), func(data map[string]interface{}) int {
+		return this.DBWriter.Insert(this.table, data)
+	})
+
+	if nil != this.cache && this.cache.NegativeTTL > 0 {
+		this.DelCache(id)
+	}
+
+	return id
 } // }}}
 
 func (this *DAOProxy) SetRecord(vals interface{}, id interface{}) int { //{{{
-	return this.DBWriter.Update(this.table, this.preParams(vals), this.primary+"=?", id)
+	defer this.DelCache(id)
+	data, cur, check := this.updateValues(this.preParams(vals))
+	return this.change(ACTION_UPDATE, id, "", nil, data, func(data map[string]interface{}) int {
+		return this.update(data, this.primary+"=?", []interface{}{id}, id, cur, check)
+	})
 } // }}}
 
 func (this *DAOProxy) SetRecordBy(vals interface{}, where string, params ...interface{}) int { //{{{
-	return this.DBWriter.Update(this.table, this.preParams(vals), where, params...)
+	defer this.DelCache(this.cachedIds(where, params)...)
+	data, cur, check := this.updateValues(this.preParams(vals))
+	return this.change(ACTION_UPDATE, nil, where, params, data, func(data map[string]interface{}) int {
+		return this.update(data, where, params, nil, cur, check)
+	})
 } // }}}
 
 func (this *DAOProxy) ResetRecord(vals interface{}) int { //{{{
-	return this.DBWriter.Replace(this.table, this.preParams(vals))
+	data := this.fillTimestamps(this.preParams(vals), true)
+	id := this.change(ACTION_REPLACE, data[this.primary], "", nil, data, func(data map[string]interface{}) int {
+		return this.DBWriter.Replace(this.table, data)
+	})
+
+	if pk, ok := data[this.primary]; ok {
+		this.DelCache(pk)
+	} else {
+		this.DelCache(id)
+	}
+
+	return id
 } // }}}
 
+//开启缓存(SetCache)时, 未指定字段(或通过Bind指定)的查询优先读取缓存
 func (this *DAOProxy) GetRecord(id interface{}) map[string]interface{} { //{{{
-	row := this.GetDBReader().GetRow("select "+this.GetFields()+" from "+this.table+" where "+this.primary+"=?  limit 1", id)
+	var row map[string]interface{}
+	if this.useCache() {
+		this.fields = ""
+		this.bindFields = false
+		//缓存的记录保留 NULL, 供 Bind 与否的读取共用; 从主库读取, 避免删除缓存后从延迟的从库读到旧记录并缓存
+		row = this.cachedRecord(id, func() map[string]interface{} {
+			return this.getRecord(this.DBWriter.WithNull(), id)
+		})
+	} else {
+		row = this.getRecord(this.recordReader(), id)
+	}
 
 	if len(row) > 0 && nil != this.bind {
 		this.parseRecord(row)
 	}
 
+	emptyNull(row)
+
 	return row
 
 } // }}}
 
+func (this *DAOProxy) getRecord(reader db.DBClient, id interface{}) map[string]interface{} { //{{{
+	where, values := this.scopeWhere(this.primary+"=?", []interface{}{id})
+	return reader.GetRow("select "+this.GetFields()+" from "+this.table+" where "+where+"  limit 1", values...)
+} // }}}
+
+//是否读取缓存: 未使用事务、未强制读主库、未读取已删除记录, 且使用默认字段
+func (this *DAOProxy) useCache() bool { //{{{
+	return nil != this.cache && !this.intx && !this.forceMaster && !this.behavior.withDeleted && ("" == this.fields || this.bindFields)
+} // }}}
+
+//开启软删除时只更新删除标记, 可通过 ForceDelete() 物理删除
 func (this *DAOProxy) DelRecord(id interface{}) int { //{{{
-	return this.DBWriter.Execute("delete from "+this.table+" where "+this.primary+"=? limit 1", id)
+	defer this.DelCache(id)
+	return this.change(ACTION_DELETE, id, "", nil, nil, func(map[string]interface{}) int {
+		return this.delete(this.primary+"=?", []interface{}{id}, " limit 1")
+	})
 } // }}}
 
 func (this *DAOProxy) DelRecordBy(params ...interface{}) int { //{{{
 	where, values := this.parseParams(params...)
-	return this.DBWriter.Execute("delete from "+this.table+" where "+where+" limit 1", values...)
+	defer this.DelCache(this.cachedIds(where, values)...)
+	return this.change(ACTION_DELETE, nil, where+" limit 1", values, nil, func(map[string]interface{}) int {
+		return this.delete(where, values, " limit 1")
+	})
 } // }}}
 
 //Is Dangerous!
 func (this *DAOProxy) DelRecords(params ...interface{}) int { //{{{
 	where, values := this.parseParams(params...)
-	return this.DBWriter.Execute("delete from "+this.table+" where "+where, values...)
+	defer this.DelCache(this.cachedIds(where, values)...)
+	return this.change(ACTION_DELETE, nil, where, values, nil, func(map[string]interface{}) int {
+		return this.delete(where, values, "")
+	})
 } // }}}
 
 func (this *DAOProxy) GetOne(field string, params ...interface{}) interface{} { //{{{
-	where, values := this.parseParams(params...)
+	where, values := this.scopeWhere(this.parseParams(params...))
 	if "" != where {
 		where = " where " + where
 	}
@@ -508,7 +561,7 @@ func (this *DAOProxy) GetValue(field string, params ...interface{}) interface{}
 } // }}}
 
 func (this *DAOProxy) GetValues(field string, params ...interface{}) []interface{} { //{{{
-	where, values := this.parseParams(params...)
+	where, values := this.scopeWhere(this.parseParams(params...))
 	if "" != where {
 		where = " where " + where
 	}
@@ -518,7 +571,7 @@ func (this *DAOProxy) GetValues(field string, params ...interface{}) []interface
 } // }}}
 
 func (this *DAOProxy) GetValuesMap(keyfield, valfield string, params ...interface{}) x.MAP { //{{{
-	where, values := this.parseParams(params...)
+	where, values := this.scopeWhere(this.parseParams(params...))
 	if "" != where {
 		where = " where " + where
 	}
@@ -528,7 +581,7 @@ func (this *DAOProxy) GetValuesMap(keyfield, valfield string, params ...interfac
 } // }}}
 
 func (this *DAOProxy) GetCount(params ...interface{}) int { //{{{
-	where, values := this.parseParams(params...)
+	where, values := this.scopeWhere(this.parseParams(params...))
 	if "" != where {
 		where = " where " + where
 	}
@@ -553,12 +606,12 @@ func (this *DAOProxy) ExistsBy(params ...interface{}) bool { //{{{
 } // }}}
 
 func (this *DAOProxy) GetRecordBy(params ...interface{}) map[string]interface{} { //{{{
-	where, values := this.parseParams(params...)
+	where, values := this.scopeWhere(this.parseParams(params...))
 	if "" != where {
 		where = " where " + where
 	}
 
-	row := this.GetDBReader().GetRow("select "+this.GetFields()+" from "+this.table+where+" limit 1", values...)
+	row := this.recordReader().GetRow("select "+this.GetFields()+" from "+this.table+where+" limit 1", values...)
 
 	if len(row) > 0 && nil != this.bind {
 		this.parseRecord(row)
@@ -568,7 +621,7 @@ func (this *DAOProxy) GetRecordBy(params ...interface{}) map[string]interface{}
 } // }}}
 
 func (this *DAOProxy) GetRecords(params ...interface{}) []map[string]interface{} { //{{{
-	where, values := this.parseParams(params...)
+	where, values := this.scopeWhere(this.parseParams(params...))
 
 	if "" != where {
 		where = " where " + where
@@ -590,7 +643,7 @@ func (this *DAOProxy) GetRecords(params ...interface{}) []map[string]interface{}
 		where = where + " limit " + limit
 	}
 
-	list := this.GetDBReader().GetAll("select "+this.GetFields()+" from "+this.table+fidx+where, values...)
+	list := this.recordReader().GetAll("select "+this.GetFields()+" from "+this.table+fidx+where, values...)
 
 	if len(list) > 0 && nil != this.bind {
 		this.parseRecords(list)
@@ -599,10 +652,10 @@ func (this *DAOProxy) GetRecords(params ...interface{}) []map[string]interface{}
 	return list
 } // }}}
 
-//大数据下会有性能问题，请谨慎使用
+//大数据下会有性能问题，请谨慎使用, 可使用 GetPage 游标分页代替
 //由于底层每次查询都是从连接池中获取连接，所以开启只读事务，以保证FOUND_ROWS()的两条sql使用同一连接
 func (this *DAOProxy) GetList(params ...interface{}) (int, []map[string]interface{}) { //{{{
-	where, values := this.parseParams(params...)
+	where, values := this.scopeWhere(this.parseParams(params...))
 
 	if "" != where {
 		where = " where " + where
@@ -624,7 +677,7 @@ func (this *DAOProxy) GetList(params ...interface{}) (int, []map[string]interfac
 		where = where + " limit " + limit
 	}
 
-	reader := this.GetDBReader().Begin(true)
+	reader := this.recordReader().Begin(true)
 	defer reader.Rollback()
 
 	list := reader.GetAll("select SQL_CALC_FOUND_ROWS "+this.GetFields()+" from "+this.table+fidx+where, values...)
@@ -0,0 +1,127 @@
+package dao
+
+import (
+	"github.com/mlaoji/ygo/x"
+	"github.com/mlaoji/ygo/x/db"
+	"testing"
+)
+
+type testUser struct {
+	Uid  int     `db:"uid"`
+	Name string  `db:"name"`
+	Nick *string `db:"nick"`
+}
+
+//使用 FakeClient 替换 db 配置, 不需要连接数据库
+func newTestDAO(t *testing.T) (*DAOProxy, *db.FakeClient) { // {{{
+	fake := db.NewFakeClient()
+	restore := x.DB.Set("db_test", fake)
+	t.Cleanup(func() {
+		x.DB.Set("db_test", restore)
+	})
+
+	dao := &DAOProxy{}
+	dao.Init("db_test")
+	dao.SetTable("user")
+	dao.SetPrimary("uid")
+
+	return dao, fake
+} // }}}
+
+func TestFakeInsert(t *testing.T) { // {{{
+	dao, fake := newTestDAO(t)
+
+	if id := dao.AddRecord(&testUser{Name: "a"}); 1 != id {
+		t.Fatalf("AddRecord id = %d, want 1", id)
+	}
+
+	if id := dao.AddRecord(map[string]interface{}{"name": "b"}); 2 != id {
+		t.Fatalf("AddRecord id = %d, want 2", id)
+	}
+
+	fake.ExpectQuery(t, "^insert into user set name=\\?,nick=\\?,uid=\\?", "a", nil, 0)
+	fake.ExpectQuery(t, "^insert into user set name=\\?$", "b")
+
+	fake.Reset()
+	if id := dao.AddRecord(map[string]interface{}{"name": "c"}); 1 != id {
+		t.Fatalf("AddRecord id after Reset = %d, want 1", id)
+	}
+} // }}}
+
+func TestFakeGet(t *testing.T) { // {{{
+	dao, fake := newTestDAO(t)
+	fake.On("^select .* from user where uid=\\?").Return(map[string]interface{}{"uid": 1, "name": "a", "nick": nil})
+
+	row := dao.GetRecord(1)
+	if "1" != row["uid"] || "a" != row["name"] || "" != row["nick"] {
+		t.Fatalf("GetRecord = %v", row)
+	}
+
+	user := &testUser{}
+	dao.Bind(user).GetRecord(1)
+	if 1 != user.Uid || "a" != user.Name || nil != user.Nick {
+		t.Fatalf("Bind GetRecord = %+v", user)
+	}
+
+	fake.ExpectQueryCount(t, 2)
+} // }}}
+
+func TestFakeUpdate(t *testing.T) { // {{{
+	dao, fake := newTestDAO(t)
+	fake.On("^update user").ReturnAffected(0).Times(1)
+
+	if n := dao.SetRecord(map[string]interface{}{"name": "b"}, 1); 0 != n {
+		t.Fatalf("SetRecord = %d, want 0", n)
+	}
+
+	if n := dao.SetRecord(map[string]interface{}{"name": "c"}, 1); 1 != n {
+		t.Fatalf("SetRecord = %d, want 1", n)
+	}
+
+	fake.ExpectQuery(t, "^update user set name=\\? where uid=\\?", "c", 1)
+} // }}}
+
+func TestFakeTx(t *testing.T) { // {{{
+	dao, fake := newTestDAO(t)
+
+	committed := 0
+	tx := fake.Begin(false)
+	tx_dao := &DAOProxy{}
+	tx_dao.InitTx(tx)
+	tx_dao.SetTable("user")
+	tx_dao.SetPrimary("uid")
+
+	tx_dao.AddRecord(map[string]interface{}{"name": "a"})
+	tx.AfterCommit(func() {
+		committed++
+	})
+
+	if 0 != committed {
+		t.Fatal("AfterCommit ran before commit")
+	}
+
+	tx.Commit()
+	if 1 != committed {
+		t.Fatal("AfterCommit did not run after commit")
+	}
+
+	tx = fake.Begin(false)
+	tx.AfterCommit(func() {
+		committed++
+	})
+	tx.Rollback()
+
+	begins, commits, rollbacks := fake.TxCount()
+	if 2 != begins || 1 != commits || 1 != rollbacks || 1 != committed {
+		t.Fatalf("TxCount = %d, %d, %d, committed = %d", begins, commits, rollbacks, committed)
+	}
+
+	if q := fake.ExpectQuery(t, "^insert into user"); nil != q && !q.Tx {
+		t.Fatal("insert not executed in transaction")
+	}
+
+	dao.GetRecord(1)
+	if q := fake.ExpectQuery(t, "^select"); nil != q && q.Tx {
+		t.Fatal("select executed in transaction")
+	}
+} // }}}
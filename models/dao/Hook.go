@@ -0,0 +1,164 @@
+package dao
+
+import (
+	"fmt"
+	"github.com/mlaoji/ygo/x"
+	"sync"
+)
+
+//写操作类型
+const (
+	ACTION_INSERT  = "insert"
+	ACTION_REPLACE = "replace"
+	ACTION_UPDATE  = "update"
+	ACTION_DELETE  = "delete"
+	ACTION_RESTORE = "restore"
+)
+
+//数据变更事件
+type ChangeEvent struct {
+	Table    string
+	DB       string //写库 ID
+	Action   string
+	Id       interface{}            //主键, 按条件写入且未开启预读时为nil
+	Where    string                 //按条件写入时的条件(DelRecordBy 包含 limit)
+	Params   []interface{}          //按条件写入时的参数
+	Old      map[string]interface{} //变更前的记录, 开启预读(SetPreRead)时才有
+	New      map[string]interface{} //写入的值, 删除时为nil; before 钩子中可修改
+	InTx     bool                   //是否在事务中, 在事务中时 after 钩子在事务提交后执行, 回滚则不执行
+	Affected int                    //影响行数(或新增的id), 仅 after 钩子中有效
+}
+
+//before 钩子在写入前同步执行, panic 会中止写入; after 钩子中的 panic 会被记录日志并忽略
+type HookFunc func(e *ChangeEvent)
+
+var (
+	hookMutex   sync.RWMutex
+	beforeHooks []HookFunc
+	afterHooks  []HookFunc
+)
+
+//注册全局 before 钩子, 对所有 DAO 生效, 一般在 init 中调用
+func BeforeWrite(fn HookFunc) { // {{{
+	hookMutex.Lock()
+	defer hookMutex.Unlock()
+
+	beforeHooks = append(beforeHooks, fn)
+} // }}}
+
+//注册全局 after 钩子, 对所有 DAO 生效, 一般在 init 中调用
+func AfterWrite(fn HookFunc) { // {{{
+	hookMutex.Lock()
+	defer hookMutex.Unlock()
+
+	afterHooks = append(afterHooks, fn)
+} // }}}
+
+//注册当前 DAO 的 before 钩子, 在 DAO 的 Init 方法中调用
+func (this *DAOProxy) BeforeWrite(fn HookFunc) *DAOProxy { // {{{
+	this.beforeHooks = append(this.beforeHooks, fn)
+	return this
+} // }}}
+
+//注册当前 DAO 的 after 钩子, 在 DAO 的 Init 方法中调用
+func (this *DAOProxy) AfterWrite(fn HookFunc) *DAOProxy { // {{{
+	this.afterHooks = append(this.afterHooks, fn)
+	return this
+} // }}}
+
+//更新及删除前从主库预读受影响的记录, 用于钩子中比较新旧值; 按条件写入时每条记录触发一次事件
+func (this *DAOProxy) SetPreRead(open bool) *DAOProxy { // {{{
+	this.preRead = open
+	return this
+} // }}}
+
+func (this *DAOProxy) hooks() ([]HookFunc, []HookFunc) { // {{{
+	hookMutex.RLock()
+	defer hookMutex.RUnlock()
+
+	before := append(append([]HookFunc{}, beforeHooks...), this.beforeHooks...)
+	after := append(append([]HookFunc{}, afterHooks...), this.afterHooks...)
+
+	return before, after
+} // }}}
+
+//执行写操作并触发钩子, id 为nil时表示按 where 条件写入
+func (this *DAOProxy) change(action string, id interface{}, where string, params []interface{}, data map[string]interface{}, write func(data map[string]interface{}) int) int { // {{{
+	before, after := this.hooks()
+	if 0 == len(before) && 0 == len(after) {
+		return write(data)
+	}
+
+	events := []*ChangeEvent{}
+	if this.preRead && ACTION_INSERT != action {
+		rows := []map[string]interface{}{}
+		if nil != id {
+			if row := this.DBWriter.GetRow("select * from "+this.table+" where "+this.primary+"=? limit 1", id); len(row) > 0 {
+				rows = append(rows, row)
+			}
+		} else if "" != where {
+			rows = this.DBWriter.GetAll("select * from "+this.table+" where "+where, params...)
+		}
+
+		for _, row := range rows {
+			events = append(events, this.newEvent(action, row[this.primary], where, params, row, data))
+		}
+	}
+
+	if 0 == len(events) {
+		events = append(events, this.newEvent(action, id, where, params, nil, data))
+	}
+
+	for _, e := range events {
+		for _, fn := range before {
+			fn(e)
+		}
+	}
+
+	affected := write(data)
+
+	for _, e := range events {
+		e.Affected = affected
+		if (ACTION_INSERT == action || ACTION_REPLACE == action) && nil == e.Id {
+			e.Id = affected
+		}
+	}
+
+	if 0 == len(after) {
+		return affected
+	}
+
+	this.DBWriter.AfterCommit(func() {
+		for _, e := range events {
+			for _, fn := range after {
+				runAfterHook(fn, e)
+			}
+		}
+	})
+
+	return affected
+} // }}}
+
+func (this *DAOProxy) newEvent(action string, id interface{}, where string, params []interface{}, old, data map[string]interface{}) *ChangeEvent { // {{{
+	return &ChangeEvent{
+		Table:  this.table,
+		DB:     this.DBWriter.ID(),
+		Action: action,
+		Id:     id,
+		Where:  where,
+		Params: params,
+		Old:    old,
+		New:    data,
+		InTx:   this.intx,
+	}
+} // }}}
+
+func runAfterHook(fn HookFunc, e *ChangeEvent) { // {{{
+	defer func() {
+		if err := recover(); err != nil {
+			x.Logger.Warn("dao after hook error:", e.Table, e.Action, e.Id, fmt.Sprint(err))
+		}
+	}()
+
+	fn(e)
+} // }}}
@@ -0,0 +1,320 @@
+package dao
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"github.com/mlaoji/ygo/x"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	//time.Time 字段读写时使用的默认格式, 可通过 tag 指定, 如: `db:"birthday,layout=2006-01-02"`
+	TimeLayout = "2006-01-02 15:04:05"
+
+	timeType    = reflect.TypeOf(time.Time{})
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+	fieldsCache sync.Map //key: reflect.Type value: []*fieldInfo
+)
+
+//struct 字段与表字段的映射
+//tag 格式: `db:"name[,omitempty][,json][,unix][,layout=2006-01-02]"`
+//omitempty: 写入时忽略零值
+//json: 以json格式存储, 读取时反序列化
+//unix: time.Time 以unix时间戳(int)存储
+//layout: time.Time 以指定格式存储, 零值写入 NULL
+type fieldInfo struct {
+	name      string
+	index     []int
+	omitempty bool
+	json      bool
+	unix      bool
+	layout    string
+}
+
+//解析struct的字段映射, 匿名struct字段(未指定tag时)展开
+func structFields(typ reflect.Type) []*fieldInfo { // {{{
+	if v, ok := fieldsCache.Load(typ); ok {
+		return v.([]*fieldInfo)
+	}
+
+	fields := []*fieldInfo{}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+
+		tag := f.Tag.Get("db")
+		if tag == "-" || tag == "nil" {
+			continue
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if f.Anonymous && tag == "" && ft.Kind() == reflect.Struct && ft != timeType && !reflect.PtrTo(ft).Implements(scannerType) {
+			for _, sub := range structFields(ft) {
+				fi := *sub
+				fi.index = append([]int{i}, sub.index...)
+				fields = append(fields, &fi)
+			}
+			continue
+		}
+
+		if f.PkgPath != "" { //未导出字段
+			continue
+		}
+
+		opts := strings.Split(tag, ",")
+		fi := &fieldInfo{name: strings.TrimSpace(opts[0]), index: []int{i}}
+		if fi.name == "" {
+			fi.name = strings.ToLower(f.Name)
+		}
+
+		for _, opt := range opts[1:] {
+			opt = strings.TrimSpace(opt)
+			switch {
+			case opt == "omitempty":
+				fi.omitempty = true
+			case opt == "json":
+				fi.json = true
+			case opt == "unix":
+				fi.unix = true
+			case strings.HasPrefix(opt, "layout="):
+				fi.layout = strings.TrimPrefix(opt, "layout=")
+			}
+		}
+
+		fields = append(fields, fi)
+	}
+
+	fieldsCache.Store(typ, fields)
+
+	return fields
+} // }}}
+
+//按索引路径获取字段, alloc 为true时为nil的嵌入指针分配内存, 否则返回无效值
+func fieldByIndex(v reflect.Value, index []int, alloc bool) reflect.Value { // {{{
+	for i, idx := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc || !v.CanSet() {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(idx)
+	}
+
+	return v
+} // }}}
+
+//读取的值赋给字段, 值为 nil 时(或空字符串赋给非字符串指针时)视为 NULL
+func setField(field reflect.Value, fi *fieldInfo, value interface{}) { // {{{
+	typ := field.Type()
+
+	if typ.Kind() == reflect.Ptr {
+		str, isstr := value.(string)
+		if nil == value || (isstr && "" == str && typ.Elem().Kind() != reflect.String && !reflect.PtrTo(typ.Elem()).Implements(scannerType)) {
+			field.Set(reflect.Zero(typ))
+			return
+		}
+
+		elem := reflect.New(typ.Elem())
+		setField(elem.Elem(), fi, value)
+		field.Set(elem)
+		return
+	}
+
+	if field.CanAddr() && field.Addr().Type().Implements(scannerType) {
+		scanner := field.Addr().Interface().(sql.Scanner)
+		if err := scanner.Scan(value); err != nil {
+			//未保留 NULL 时(如 Fillin 传入的 map)读取为空字符串, 按 NULL 重试
+			if "" != value || nil != scanner.Scan(nil) {
+				panic(err)
+			}
+		}
+		return
+	}
+
+	str := ""
+	switch v := value.(type) {
+	case nil:
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	default:
+		str = fmt.Sprint(v)
+	}
+
+	if fi.json {
+		if "" != str {
+			if err := json.Unmarshal([]byte(str), field.Addr().Interface()); err != nil {
+				panic(err)
+			}
+		}
+		return
+	}
+
+	if typ == timeType {
+		field.Set(reflect.ValueOf(parseTime(str, fi)))
+		return
+	}
+
+	kind := typ.Kind()
+	if "" == str && kind != reflect.String && kind != reflect.Slice {
+		field.Set(reflect.Zero(typ))
+		return
+	}
+
+	switch kind {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			panic(err)
+		}
+		field.SetBool(b)
+	case reflect.String:
+		field.SetString(str)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(str, 0, 64)
+		if err != nil {
+			panic(err)
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(str, 0, 64)
+		if err != nil {
+			panic(err)
+		}
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			panic(err)
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if typ.Elem().Kind() != reflect.Uint8 {
+			panic(fmt.Sprintf("unsupported type: %s", typ.String()))
+		}
+		field.SetBytes([]byte(str))
+	default:
+		panic(fmt.Sprintf("unsupported type: %s", typ.String()))
+	}
+} // }}}
+
+//NULL(nil) 转为空字符串, 与未 Bind 时返回的记录一致
+func emptyNull(row map[string]interface{}) { // {{{
+	for k, v := range row {
+		if nil == v {
+			row[k] = ""
+		}
+	}
+} // }}}
+
+//字段值转换为写入参数, skip 为true时忽略此字段
+func fieldParam(field reflect.Value, fi *fieldInfo) (param interface{}, skip bool) { // {{{
+	if !field.IsValid() {
+		return nil, true
+	}
+
+	if fi.omitempty && field.IsZero() {
+		return nil, true
+	}
+
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return nil, false
+		}
+
+		if !field.Type().Implements(valuerType) {
+			field = field.Elem()
+		}
+	}
+
+	if field.Type().Implements(valuerType) {
+		v, err := field.Interface().(driver.Valuer).Value()
+		if err != nil {
+			panic(err)
+		}
+		return v, false
+	}
+
+	if fi.json {
+		b, err := json.Marshal(field.Interface())
+		if err != nil {
+			panic(err)
+		}
+		return string(b), false
+	}
+
+	if t, ok := field.Interface().(time.Time); ok {
+		return formatTime(t, fi), false
+	}
+
+	return field.Interface(), false
+} // }}}
+
+func parseTime(str string, fi *fieldInfo) time.Time { // {{{
+	if "" == str || strings.HasPrefix(str, "0000-00-00") {
+		return time.Time{}
+	}
+
+	if fi.unix {
+		sec, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			panic(err)
+		}
+		if 0 == sec {
+			return time.Time{}
+		}
+		return time.Unix(sec, 0).In(x.GetLoc())
+	}
+
+	layouts := []string{TimeLayout, "2006-01-02 15:04:05.999999999", "2006-01-02"}
+	if "" != fi.layout {
+		layouts = append([]string{fi.layout}, layouts...)
+	}
+
+	var err error
+	var t time.Time
+	for _, layout := range layouts {
+		if t, err = time.ParseInLocation(layout, str, x.GetLoc()); nil == err {
+			return t
+		}
+	}
+
+	panic(err)
+} // }}}
+
+func formatTime(t time.Time, fi *fieldInfo) interface{} { // {{{
+	if fi.unix {
+		if t.IsZero() {
+			return 0
+		}
+		return t.Unix()
+	}
+
+	//零值写入 NULL, 0001-01-01 在严格模式下无法写入 DATETIME 字段
+	if t.IsZero() {
+		return nil
+	}
+
+	layout := TimeLayout
+	if "" != fi.layout {
+		layout = fi.layout
+	}
+
+	return t.In(x.GetLoc()).Format(layout)
+} // }}}
@@ -0,0 +1,312 @@
+package gen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/mlaoji/ygo/x"
+	"github.com/mlaoji/ygo/x/db"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+var (
+	//文件已存在且不能合并
+	ErrFileExists = errors.New("file exists")
+
+	moduleReg = regexp.MustCompile(`(?m)^module\s+(\S+)`)
+)
+
+//root: 项目根目录(包含 src/models), 为空时使用 x.AppRoot
+func NewGenerator(conf_name, root string) *Generator { // {{{
+	if "" == conf_name {
+		conf_name = "db_master"
+	}
+
+	if "" == root {
+		root = x.AppRoot
+	}
+
+	return &Generator{
+		ConfName: conf_name,
+		Root:     root,
+	}
+} // }}}
+
+type Generator struct {
+	ConfName string //db配置名
+	Root     string //项目根目录
+	App      string //项目包名, 为空时读取 go.mod 中的 module, 否则使用根目录名
+	Force    bool   //文件存在且不包含生成区域标记时, 备份后覆盖
+	client   db.DBClient
+}
+
+type finder struct {
+	Index  string
+	Unique bool
+	Method string
+	Args   string
+	Where  string
+	Params string
+}
+
+//生成 dao 文件: src/models/dao/DAO{Name}.go, hash_num > 1 时为分表, 从 {table}_0 读取表结构
+func (this *Generator) GenDao(table string, hash_num int) (string, error) { // {{{
+	data, err := this.tableData(table, hash_num)
+	if err != nil {
+		return "", err
+	}
+
+	file := filepath.Join(this.Root, "src", "models", "dao", "DAO"+data["Name"].(string)+".go")
+	return file, this.render(file, daoTpl, data, true, data["Imports"].([]string)...)
+} // }}}
+
+//生成 model 文件: src/models/{Name}.go, 文件已存在时不覆盖(除非指定Force)
+func (this *Generator) GenModel(table string, hash_num int) (string, error) { // {{{
+	data, err := this.tableData(table, hash_num)
+	if err != nil {
+		return "", err
+	}
+
+	data["App"] = this.getApp()
+
+	file := filepath.Join(this.Root, "src", "models", data["Name"].(string)+".go")
+	return file, this.render(file, modelTpl, data, false)
+} // }}}
+
+//生成 rpc client model 文件: src/models/{Service}.go, methods 格式: service/method
+func (this *Generator) GenRpcModel(service string, methods []string) (string, error) { // {{{
+	service = strings.ToLower(service)
+	name := ToCamel(service)
+
+	list := []map[string]string{}
+	for _, m := range methods {
+		m = strings.Trim(m, " /")
+		if "" == m {
+			continue
+		}
+
+		parts := strings.Split(m, "/")
+		if len(parts) != 2 {
+			return "", fmt.Errorf("invalid method: %s, need service/method", m)
+		}
+
+		list = append(list, map[string]string{"Name": strings.Title(parts[1]), "Uri": m})
+	}
+
+	data := map[string]interface{}{
+		"Name":    name,
+		"Service": service,
+		"Methods": list,
+	}
+
+	file := filepath.Join(this.Root, "src", "models", name+".go")
+	return file, this.render(file, rpcTpl, data, true)
+} // }}}
+
+func (this *Generator) tableData(table string, hash_num int) (data map[string]interface{}, err error) { // {{{
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+
+	if nil == this.client {
+		this.client = x.DB.Get(this.ConfName)
+	}
+
+	table = strings.ToLower(table)
+	schema_table := table
+	if hash_num > 1 {
+		schema_table = table + "_0"
+	} else {
+		hash_num = 0
+	}
+
+	t := ReadTable(this.client, schema_table)
+
+	imports := []string{}
+	for _, c := range t.Columns {
+		if strings.HasSuffix(c.GoType, "time.Time") {
+			imports = append(imports, "time")
+			break
+		}
+	}
+
+	primary := "id"
+	primary_name := "Id"
+	primary_type := "int"
+	if nil != t.Primary {
+		primary = t.Primary.Name
+		primary_name = t.Primary.GoName
+		primary_type = t.Primary.GoType
+	}
+
+	//单字段主键时 dao 中生成 GetBy{主键} 方法, model 中生成 Get{Name}Info; 无主键或联合主键时不生成 Get{Name}Info
+	primary_finder := false
+	for _, idx := range t.Indexes {
+		if "PRIMARY" == idx.Name {
+			primary_finder = nil != t.Primary && 1 == len(idx.Columns) && idx.Columns[0] == t.Primary
+			break
+		}
+	}
+
+	//多个索引包含相同的字段时只生成一个方法, 优先使用唯一索引
+	finders := []*finder{}
+	finder_idx := map[string]int{}
+	for _, idx := range t.Indexes {
+		if 0 == len(idx.Columns) {
+			continue
+		}
+
+		names, args, where, params := []string{}, []string{}, []string{}, []string{}
+		for _, c := range idx.Columns {
+			arg := lcfirst(c.GoName)
+			names = append(names, c.GoName)
+			args = append(args, arg+" "+c.GoType)
+			where = append(where, "`"+c.Name+"`=?")
+			params = append(params, arg)
+		}
+
+		prefix := "GetBy"
+		if !idx.Unique {
+			prefix = "GetListBy"
+		}
+
+		f := &finder{
+			Index:  idx.Name,
+			Unique: idx.Unique,
+			Method: prefix + strings.Join(names, "And"),
+			Args:   strings.Join(args, ", "),
+			Where:  strings.Join(where, " and "),
+			Params: strings.Join(params, ", "),
+		}
+
+		key := strings.Join(names, ",")
+		if i, ok := finder_idx[key]; ok {
+			if f.Unique && !finders[i].Unique {
+				finders[i] = f
+			}
+			continue
+		}
+
+		finder_idx[key] = len(finders)
+		finders = append(finders, f)
+	}
+
+	return map[string]interface{}{
+		"Name":          ToCamel(table),
+		"TableName":     table,
+		"Table":         t,
+		"HashNum":       hash_num,
+		"Primary":       primary,
+		"PrimaryName":   primary_name,
+		"PrimaryType":   primary_type,
+		"PrimaryFinder": primary_finder,
+		"ShardExpr":     shardExpr(primary_type, hash_num),
+		"Finders":       finders,
+		"Imports":       imports,
+	}, nil
+} // }}}
+
+//渲染模板并写入文件
+//merge: 文件已存在时, 是否按生成区域标记合并, imports: 合并时需要补充的import
+func (this *Generator) render(file string, tpl *template.Template, data interface{}, merge bool, imports ...string) error { // {{{
+	buf := bytes.NewBufferString("")
+	if err := tpl.Execute(buf, data); err != nil {
+		return err
+	}
+
+	content, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("format %s error: %v", file, err)
+	}
+
+	if isfile, _ := x.IsFile(file); isfile {
+		old, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		var merged []byte
+		found := false
+		if merge {
+			merged, found, err = MergeRegions(old, content)
+			if err != nil {
+				return fmt.Errorf("merge %s error: %v", file, err)
+			}
+		}
+
+		if found {
+			if merged, err = EnsureImports(merged, imports...); err != nil {
+				return fmt.Errorf("merge %s error: %v", file, err)
+			}
+
+			//合并后不再使用的生成代码依赖(如删除了时间字段)
+			if merged, err = RemoveUnusedImports(merged, "time"); err != nil {
+				return fmt.Errorf("merge %s error: %v", file, err)
+			}
+
+			if content, err = format.Source(merged); err != nil {
+				return fmt.Errorf("format %s error: %v", file, err)
+			}
+
+			if bytes.Equal(old, content) {
+				return nil
+			}
+		} else if this.Force {
+			if err = os.Rename(file, file+".bak"); err != nil {
+				return err
+			}
+
+			fmt.Println("backup file saved at [" + file + ".bak]")
+		} else {
+			return ErrFileExists
+		}
+	}
+
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, content, 0644)
+} // }}}
+
+//分表时由主键计算表序号的表达式, 主键变量名为 id
+func shardExpr(typ string, hash_num int) string { // {{{
+	n := fmt.Sprint(hash_num)
+	switch strings.TrimPrefix(typ, "*") {
+	case "int":
+		if strings.HasPrefix(typ, "*") {
+			return "*id%" + n
+		}
+		return "id%" + n
+	case "int64", "uint64":
+		if strings.HasPrefix(typ, "*") {
+			return "int(*id%" + n + ")"
+		}
+		return "int(id%" + n + ")"
+	}
+
+	return "x.AsInt(id)%" + n
+} // }}}
+
+func (this *Generator) getApp() string { // {{{
+	if "" != this.App {
+		return this.App
+	}
+
+	if content, err := ioutil.ReadFile(filepath.Join(this.Root, "go.mod")); nil == err {
+		if m := moduleReg.FindSubmatch(content); nil != m {
+			return string(m[1])
+		}
+	}
+
+	abs, _ := filepath.Abs(this.Root)
+	return filepath.Base(abs)
+} // }}}
@@ -0,0 +1,203 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+//生成代码区域标记, 标记之间的代码在重新生成时会被覆盖, 标记之外的代码保持不变
+const (
+	REGION_BEGIN = "//ygo:gen:begin "
+	REGION_END   = "//ygo:gen:end "
+)
+
+type region struct {
+	name  string
+	start int //begin 标记所在行
+	end   int //end 标记所在行
+}
+
+//解析文件中的生成区域
+func parseRegions(lines []string) ([]*region, error) { // {{{
+	regions := []*region{}
+	var cur *region
+
+	for i, line := range lines {
+		l := strings.TrimSpace(line)
+		if strings.HasPrefix(l, REGION_BEGIN) {
+			if nil != cur {
+				return nil, fmt.Errorf("line %d: region %s is not closed", i+1, cur.name)
+			}
+
+			cur = &region{name: strings.TrimSpace(strings.TrimPrefix(l, REGION_BEGIN)), start: i}
+		} else if strings.HasPrefix(l, REGION_END) {
+			name := strings.TrimSpace(strings.TrimPrefix(l, REGION_END))
+			if nil == cur || cur.name != name {
+				return nil, fmt.Errorf("line %d: unexpected region end %s", i+1, name)
+			}
+
+			cur.end = i
+			regions = append(regions, cur)
+			cur = nil
+		}
+	}
+
+	if nil != cur {
+		return nil, fmt.Errorf("region %s is not closed", cur.name)
+	}
+
+	return regions, nil
+} // }}}
+
+//用新生成代码中的区域替换旧文件中的同名区域, 旧文件中不存在的区域追加到文件末尾
+//返回合并后的内容及旧文件中是否存在生成区域
+func MergeRegions(old, gen []byte) ([]byte, bool, error) { // {{{
+	old_lines := strings.Split(string(old), "\n")
+	gen_lines := strings.Split(string(gen), "\n")
+
+	old_regions, err := parseRegions(old_lines)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if 0 == len(old_regions) {
+		return nil, false, nil
+	}
+
+	gen_regions, err := parseRegions(gen_lines)
+	if err != nil {
+		return nil, true, err
+	}
+
+	gen_map := map[string]*region{}
+	for _, r := range gen_regions {
+		gen_map[r.name] = r
+	}
+
+	buf := bytes.NewBufferString("")
+	merged := map[string]bool{}
+	last := 0
+	for _, r := range old_regions {
+		for _, line := range old_lines[last:r.start] {
+			buf.WriteString(line + "\n")
+		}
+
+		if g, ok := gen_map[r.name]; ok {
+			for _, line := range gen_lines[g.start : g.end+1] {
+				buf.WriteString(line + "\n")
+			}
+			merged[r.name] = true
+		} else { //新生成的代码中已不存在此区域, 保留原内容
+			for _, line := range old_lines[r.start : r.end+1] {
+				buf.WriteString(line + "\n")
+			}
+		}
+
+		last = r.end + 1
+	}
+
+	tail := strings.Join(old_lines[last:], "\n")
+	buf.WriteString(tail)
+
+	for _, r := range gen_regions {
+		if merged[r.name] {
+			continue
+		}
+
+		if !strings.HasSuffix(buf.String(), "\n") {
+			buf.WriteString("\n")
+		}
+
+		buf.WriteString("\n")
+		for _, line := range gen_lines[r.start : r.end+1] {
+			buf.WriteString(line + "\n")
+		}
+	}
+
+	return buf.Bytes(), true, nil
+} // }}}
+
+//补充缺失的import, 用于合并后的文件(import 不在生成区域中)
+func EnsureImports(src []byte, pkgs ...string) ([]byte, error) { // {{{
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	exists := map[string]bool{}
+	for _, imp := range f.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		exists[path] = true
+	}
+
+	missing := ""
+	for _, pkg := range pkgs {
+		if !exists[pkg] {
+			missing += "\t" + strconv.Quote(pkg) + "\n"
+		}
+	}
+
+	if "" == missing {
+		return src, nil
+	}
+
+	content := string(src)
+	if idx := strings.Index(content, "import (\n"); idx >= 0 {
+		idx += len("import (\n")
+		return []byte(content[:idx] + missing + content[idx:]), nil
+	}
+
+	//没有import块时, 添加到package声明之后
+	idx := strings.Index(content, "\n") + 1
+	return []byte(content[:idx] + "\nimport (\n" + missing + ")\n" + content[idx:]), nil
+} // }}}
+
+//删除未使用的import(只检查 pkgs 中的, 且未重命名的), 用于合并后生成代码不再需要的依赖
+func RemoveUnusedImports(src []byte, pkgs ...string) ([]byte, error) { // {{{
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	used := map[string]bool{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+
+	lines := strings.SplitAfter(string(src), "\n")
+	removed := false
+	for _, imp := range f.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		name := path[strings.LastIndex(path, "/")+1:]
+		if nil != imp.Name || used[name] {
+			continue
+		}
+
+		for _, pkg := range pkgs {
+			if pkg == path {
+				line := fset.Position(imp.Pos()).Line - 1
+				if strings.TrimSpace(lines[line]) == imp.Path.Value {
+					lines[line] = ""
+					removed = true
+				}
+			}
+		}
+	}
+
+	if !removed {
+		return src, nil
+	}
+
+	return []byte(strings.Join(lines, "")), nil
+} // }}}
@@ -0,0 +1,129 @@
+package gen
+
+import (
+	"github.com/mlaoji/ygo/x/db"
+	"strings"
+)
+
+//字段信息
+type Column struct {
+	Name     string
+	DataType string //如: int
+	FullType string //如: int(10) unsigned
+	Nullable bool
+	Key      string //PRI, UNI, MUL
+	Extra    string //如: auto_increment
+	Comment  string
+	GoName   string
+	GoType   string
+}
+
+//索引信息
+type Index struct {
+	Name    string
+	Unique  bool
+	Columns []*Column
+}
+
+//表结构
+type Table struct {
+	Name    string
+	Columns []*Column
+	Indexes []*Index
+	Primary *Column
+}
+
+//从 INFORMATION_SCHEMA 读取表结构
+func ReadTable(client db.DBClient, table string) *Table { // {{{
+	t := &Table{Name: table}
+
+	cols := map[string]*Column{}
+	rows := client.GetAll("select column_name as name, data_type as data_type, column_type as full_type, is_nullable as nullable, column_key as col_key, extra as extra, column_comment as comment"+
+		" from information_schema.columns where table_schema=database() and table_name=? order by ordinal_position", table)
+
+	for _, row := range rows {
+		c := &Column{
+			Name:     row["name"].(string),
+			DataType: strings.ToLower(row["data_type"].(string)),
+			FullType: strings.ToLower(row["full_type"].(string)),
+			Nullable: "YES" == row["nullable"],
+			Key:      row["col_key"].(string),
+			Extra:    row["extra"].(string),
+			Comment:  row["comment"].(string),
+		}
+		c.GoName = ToCamel(c.Name)
+		c.GoType = goType(c)
+
+		if "PRI" == c.Key && nil == t.Primary {
+			t.Primary = c
+		}
+
+		cols[c.Name] = c
+		t.Columns = append(t.Columns, c)
+	}
+
+	if 0 == len(t.Columns) {
+		panic("table not exists: " + table)
+	}
+
+	idxs := map[string]*Index{}
+	rows = client.GetAll("select index_name as name, non_unique as non_unique, column_name as col"+
+		" from information_schema.statistics where table_schema=database() and table_name=? order by index_name, seq_in_index", table)
+
+	for _, row := range rows {
+		name := row["name"].(string)
+		idx, ok := idxs[name]
+		if !ok {
+			idx = &Index{Name: name, Unique: "0" == row["non_unique"]}
+			idxs[name] = idx
+			t.Indexes = append(t.Indexes, idx)
+		}
+
+		if c, ok := cols[row["col"].(string)]; ok {
+			idx.Columns = append(idx.Columns, c)
+		}
+	}
+
+	return t
+} // }}}
+
+//mysql 类型对应的 go 类型, 可为NULL的非字符串字段使用指针
+func goType(c *Column) string { // {{{
+	unsigned := strings.Contains(c.FullType, "unsigned")
+
+	typ := "string"
+	switch c.DataType {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "year":
+		typ = "int"
+	case "bigint":
+		typ = "int64"
+		if unsigned {
+			typ = "uint64"
+		}
+	case "float", "double", "decimal", "real":
+		typ = "float64"
+	case "date", "datetime", "timestamp":
+		typ = "time.Time"
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		typ = "[]byte"
+	}
+
+	if c.Nullable && "string" != typ && "[]byte" != typ {
+		typ = "*" + typ
+	}
+
+	return typ
+} // }}}
+
+//下划线命名转为驼峰, 如: user_info => UserInfo
+func ToCamel(name string) string { // {{{
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return '_' == r || '-' == r || ' ' == r
+	})
+
+	for i, p := range parts {
+		parts[i] = strings.Title(strings.ToLower(p))
+	}
+
+	return strings.Join(parts, "")
+} // }}}
@@ -0,0 +1,171 @@
+package gen
+
+import (
+	"strings"
+	"text/template"
+)
+
+var funcs = template.FuncMap{
+	"lcfirst": lcfirst,
+	"join":    strings.Join,
+}
+
+var daoTpl = template.Must(template.New("dao").Funcs(funcs).Parse(`package dao
+
+//此文件是由 gen/model 自动生成, ygo:gen 标记之间的代码在重新生成时会被覆盖, 其余部分可按需要修改
+
+import (
+	"github.com/mlaoji/ygo/models/dao"
+	"github.com/mlaoji/ygo/x"
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+)
+
+//ygo:gen:begin struct
+
+//{{.Table.Name}} 表结构
+type {{.Name}} struct {
+{{- range .Table.Columns}}
+	{{.GoName}} {{.GoType}} ` + "`" + `db:"{{.Name}}" json:"{{.Name}}"` + "`" + `{{if .Comment}} //{{.Comment}}{{end}}
+{{- end}}
+}
+
+//ygo:gen:end struct
+{{if .HashNum}}
+func NewDAO{{.Name}}(id {{.PrimaryType}}, tx ...x.DBClient) *DAO{{.Name}} {
+	ins := &DAO{{.Name}}{}
+	ins.Init(id, tx...)
+	return ins
+}
+{{else}}
+func NewDAO{{.Name}}(tx ...x.DBClient) *DAO{{.Name}} {
+	ins := &DAO{{.Name}}{}
+	ins.Init(tx...)
+	return ins
+}
+{{end}}
+type DAO{{.Name}} struct {
+	dao.DAOProxy
+}
+{{if .HashNum}}
+func (this *DAO{{.Name}}) Init(id {{.PrimaryType}}, tx ...x.DBClient) {
+{{- else}}
+func (this *DAO{{.Name}}) Init(tx ...x.DBClient) {
+{{- end}}
+	if len(tx) > 0 {
+		this.DAOProxy.InitTx(tx[0])
+	} else {
+		this.DAOProxy.Init()
+	}
+{{- if .HashNum}}
+	this.SetTable("{{.TableName}}_" + x.ToString({{.ShardExpr}}))
+{{- else}}
+	this.SetTable("{{.TableName}}")
+{{- end}}
+	this.SetPrimary("{{.Primary}}")
+}
+
+//ygo:gen:begin finders
+{{- range .Finders}}
+{{if .Unique}}
+//按索引 {{.Index}} 查询单条记录, 不存在时返回 nil
+func (this *DAO{{$.Name}}) {{.Method}}({{.Args}}) *{{$.Name}} { // {{"{{{"}}
+	ret := &{{$.Name}}{}
+	row := this.Bind(ret).GetRecordBy("{{.Where}}", {{.Params}})
+	if 0 == len(row) {
+		return nil
+	}
+
+	return ret
+} // {{"}}}"}}
+{{else}}
+//按索引 {{.Index}} 查询多条记录
+func (this *DAO{{$.Name}}) {{.Method}}({{.Args}}) []*{{$.Name}} { // {{"{{{"}}
+	ret := []*{{$.Name}}{}
+	this.Bind(&ret).GetRecords("{{.Where}}", {{.Params}})
+
+	return ret
+} // {{"}}}"}}
+{{end}}
+{{- end}}
+//ygo:gen:end finders
+`))
+
+var modelTpl = template.Must(template.New("model").Parse(`package models
+
+//此文件是由 gen/model 自动生成, 可按需要修改
+{{if .PrimaryFinder}}
+import (
+	"{{.App}}/src/models/dao"
+)
+{{end}}
+func {{.Name}}() *{{.Name}}Model {
+	return &{{.Name}}Model{}
+}
+
+type {{.Name}}Model struct{}
+{{if .PrimaryFinder}}
+func (this *{{.Name}}Model) Get{{.Name}}Info(id {{.PrimaryType}}) *dao.{{.Name}} { // {{"{{{"}}
+{{- if .HashNum}}
+	return dao.NewDAO{{.Name}}(id).GetBy{{.PrimaryName}}(id)
+{{- else}}
+	return dao.NewDAO{{.Name}}().GetBy{{.PrimaryName}}(id)
+{{- end}}
+} // {{"}}}"}}
+{{end -}}
+`))
+
+var rpcTpl = template.Must(template.New("rpc").Parse(`package models
+
+//此文件是由 gen/rpc 自动生成, ygo:gen 标记之间的代码在重新生成时会被覆盖, 其余部分可按需要修改
+
+import (
+	"fmt"
+	"github.com/mlaoji/yclient"
+	"github.com/mlaoji/ygo/x"
+)
+
+func {{.Name}}() *{{.Name}}Model {
+	return &{{.Name}}Model{}
+}
+
+type {{.Name}}Model struct{}
+
+func (this *{{.Name}}Model) getClient() (*yclient.YClient, error) { // {{"{{{"}}
+	conf := x.Conf.GetMap("rpc_client_{{.Service}}")
+	return yclient.NewYClient(conf["host"], conf["appid"], conf["secret"])
+} // {{"}}}"}}
+
+func (this *{{.Name}}Model) request(method string, params x.MAP) (x.MAP, error) { // {{"{{{"}}
+	c, err := this.getClient()
+	if nil != err {
+		return nil, err
+	}
+
+	res, err := c.Request(method, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.GetCode() > 0 {
+		return nil, fmt.Errorf("rpc client return err: %s", res.GetMsg())
+	}
+
+	return res.GetData(), nil
+} // {{"}}}"}}
+{{range .Methods}}
+//ygo:gen:begin {{.Name}}
+func (this *{{$.Name}}Model) {{.Name}}(params x.MAP) (x.MAP, error) { // {{"{{{"}}
+	return this.request("{{.Uri}}", params)
+} // {{"}}}"}}
+//ygo:gen:end {{.Name}}
+{{end}}`))
+
+func lcfirst(s string) string { // {{{
+	if "" == s {
+		return s
+	}
+
+	return strings.ToLower(s[:1]) + s[1:]
+} // }}}
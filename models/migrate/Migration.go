@@ -0,0 +1,180 @@
+package migrate
+
+import (
+	"fmt"
+	"github.com/mlaoji/ygo/x/db"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	//默认使用的db配置名
+	DefaultConf = "db_master"
+	//sql迁移文件根目录, 每个db配置名一个子目录, 如: ../migrations/db_master/20220101120000_create_user.up.sql
+	DefaultPath = "../migrations"
+	//迁移记录表
+	TableName = "schema_migrations"
+
+	registry = map[string]map[string]*Migration{} //key: conf_name: {key: version}
+	mutex    sync.RWMutex
+
+	fileReg = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+)
+
+//一次迁移, Up/Down 为sql语句(多条以分号分隔), UpFunc/DownFunc 为go代码实现, 两者同时存在时先执行sql
+type Migration struct {
+	Version  string
+	Name     string
+	Up       string
+	Down     string
+	UpFunc   func(tx db.DBClient)
+	DownFunc func(tx db.DBClient)
+	//不在事务中执行(如需要执行大量数据操作)
+	NoTx bool
+}
+
+//注册go实现的迁移, 一般在 init 中调用, 如:
+//migrate.Register("db_master", &migrate.Migration{Version: "20220101120000", Name: "create_user", Up: "create table ...", Down: "drop table user"})
+func Register(conf_name string, m *Migration) { // {{{
+	if "" == conf_name {
+		conf_name = DefaultConf
+	}
+
+	if "" == m.Version {
+		panic("migration version is empty")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if nil == registry[conf_name] {
+		registry[conf_name] = map[string]*Migration{}
+	}
+
+	if _, ok := registry[conf_name][m.Version]; ok {
+		panic(fmt.Sprintf("migration version duplicated: %s %s", conf_name, m.Version))
+	}
+
+	registry[conf_name][m.Version] = m
+} // }}}
+
+//加载指定db配置的全部迁移(注册的及目录中的sql文件), 按版本号升序
+func Load(conf_name, path string) ([]*Migration, error) { // {{{
+	list := map[string]*Migration{}
+
+	mutex.RLock()
+	for k, v := range registry[conf_name] {
+		//复制一份, 避免合并sql文件时修改注册的对象
+		c := *v
+		list[k] = &c
+	}
+	mutex.RUnlock()
+
+	dir := filepath.Join(path, conf_name)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+
+		matches := fileReg.FindStringSubmatch(f.Name())
+		if nil == matches {
+			continue
+		}
+
+		version, name, direction := matches[1], matches[2], matches[3]
+
+		content, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := list[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			list[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration version duplicated: %s %s", conf_name, version)
+		}
+
+		if "up" == direction {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	ret := make([]*Migration, 0, len(list))
+	for _, m := range list {
+		ret = append(ret, m)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Version < ret[j].Version
+	})
+
+	return ret, nil
+} // }}}
+
+//拆分多条sql, 忽略引号及注释中的分号
+func SplitStatements(content string) []string { // {{{
+	stmts := []string{}
+	buf := strings.Builder{}
+	var quote rune
+	var prev rune
+	in_comment := false
+
+	runes := []rune(content)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+
+		if in_comment {
+			if '\n' == c {
+				in_comment = false
+				buf.WriteRune(c)
+			}
+			continue
+		}
+
+		if 0 != quote {
+			buf.WriteRune(c)
+			if c == quote && '\\' != prev {
+				quote = 0
+			}
+			prev = c
+			continue
+		}
+
+		switch {
+		case '\'' == c || '"' == c || '`' == c:
+			quote = c
+			buf.WriteRune(c)
+		case '#' == c || ('-' == c && i+1 < len(runes) && '-' == runes[i+1]):
+			in_comment = true
+		case ';' == c:
+			if stmt := strings.TrimSpace(buf.String()); "" != stmt {
+				stmts = append(stmts, stmt)
+			}
+			buf.Reset()
+		default:
+			buf.WriteRune(c)
+		}
+
+		prev = c
+	}
+
+	if stmt := strings.TrimSpace(buf.String()); "" != stmt {
+		stmts = append(stmts, stmt)
+	}
+
+	return stmts
+} // }}}
@@ -0,0 +1,242 @@
+package migrate
+
+import (
+	"fmt"
+	"github.com/mlaoji/ygo/x"
+	"github.com/mlaoji/ygo/x/db"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var nameReg = regexp.MustCompile(`^\w+$`)
+
+func NewMigrator(conf_name string, path ...string) *Migrator { // {{{
+	if "" == conf_name {
+		conf_name = DefaultConf
+	}
+
+	ins := &Migrator{
+		ConfName:    conf_name,
+		Path:        DefaultPath,
+		LockTimeout: 10,
+	}
+
+	if len(path) > 0 && "" != path[0] {
+		ins.Path = path[0]
+	}
+
+	return ins
+} // }}}
+
+type Migrator struct {
+	ConfName    string //db配置名
+	Path        string //sql迁移文件根目录
+	LockTimeout int    //获取锁超时, 单位:秒
+	client      db.DBClient
+}
+
+//迁移状态
+type MigrationStatus struct {
+	Version   string
+	Name      string
+	Applied   bool
+	AppliedAt string
+}
+
+//执行未完成的迁移, n <= 0 时执行全部
+func (this *Migrator) Up(n int) (done []*Migration, err error) { // {{{
+	err = this.withLock(func() {
+		list, applied := this.load()
+
+		for _, m := range list {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+
+			if n > 0 && len(done) >= n {
+				break
+			}
+
+			this.run(m, true)
+			done = append(done, m)
+		}
+	})
+
+	return
+} // }}}
+
+//回滚最近完成的n次迁移, n <= 0 时回滚1次
+func (this *Migrator) Down(n int) (done []*Migration, err error) { // {{{
+	if n <= 0 {
+		n = 1
+	}
+
+	err = this.withLock(func() {
+		list, applied := this.load()
+
+		for i := len(list) - 1; i >= 0 && len(done) < n; i-- {
+			m := list[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+
+			this.run(m, false)
+			done = append(done, m)
+		}
+	})
+
+	return
+} // }}}
+
+//获取全部迁移的状态
+func (this *Migrator) Status() (status []*MigrationStatus, err error) { // {{{
+	err = this.catch(func() {
+		this.init()
+		list, applied := this.load()
+
+		for _, m := range list {
+			st := &MigrationStatus{Version: m.Version, Name: m.Name}
+			if at, ok := applied[m.Version]; ok {
+				st.Applied = true
+				st.AppliedAt = at
+			}
+
+			status = append(status, st)
+		}
+	})
+
+	return
+} // }}}
+
+//在迁移目录中生成 up/down 两个sql模板文件, 返回文件路径
+func (this *Migrator) Create(name string) ([]string, error) { // {{{
+	if !nameReg.MatchString(name) {
+		return nil, fmt.Errorf("invalid migration name: %s", name)
+	}
+
+	dir := filepath.Join(this.Path, this.ConfName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	version := time.Now().Format("20060102150405")
+	files := []string{}
+	for _, direction := range []string{"up", "down"} {
+		file := filepath.Join(dir, version+"_"+name+"."+direction+".sql")
+		content := fmt.Sprintf("-- %s %s: %s\n", direction, version, name)
+
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			return files, err
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+} // }}}
+
+func (this *Migrator) init() { // {{{
+	if nil == this.client {
+		this.client = x.DB.Get(this.ConfName)
+	}
+
+	this.client.Execute("create table if not exists " + TableName + " (" +
+		"version varchar(64) not null primary key," +
+		"name varchar(255) not null default ''," +
+		"applied_at datetime not null" +
+		") engine=InnoDB default charset=utf8mb4")
+} // }}}
+
+//返回全部迁移及已完成的版本(key: version, value: 完成时间)
+func (this *Migrator) load() ([]*Migration, map[string]string) { // {{{
+	list, err := Load(this.ConfName, this.Path)
+	if err != nil {
+		panic(err)
+	}
+
+	applied := map[string]string{}
+	rows := this.client.GetAll("select version, applied_at from " + TableName)
+	for _, row := range rows {
+		applied[row["version"].(string)] = row["applied_at"].(string)
+	}
+
+	return list, applied
+} // }}}
+
+//执行单次迁移, 默认在事务中执行并同时更新迁移记录
+func (this *Migrator) run(m *Migration, up bool) { // {{{
+	stmts := SplitStatements(m.Up)
+	fn := m.UpFunc
+	if !up {
+		stmts = SplitStatements(m.Down)
+		fn = m.DownFunc
+	}
+
+	if 0 == len(stmts) && nil == fn {
+		panic(fmt.Sprintf("migration %s_%s has no %s", m.Version, m.Name, map[bool]string{true: "up", false: "down"}[up]))
+	}
+
+	executor := this.client
+	if !m.NoTx {
+		executor = this.client.Begin(false)
+		defer executor.Rollback()
+	}
+
+	for _, stmt := range stmts {
+		executor.Execute(stmt)
+	}
+
+	if nil != fn {
+		fn(executor)
+	}
+
+	if up {
+		executor.Insert(TableName, map[string]interface{}{"version": m.Version, "name": m.Name, "applied_at": x.DateTime()})
+	} else {
+		executor.Execute("delete from "+TableName+" where version=?", m.Version)
+	}
+
+	executor.Commit()
+
+	fmt.Println("migrate", map[bool]string{true: "up", false: "down"}[up], ":", m.Version, m.Name)
+} // }}}
+
+//通过 mysql GET_LOCK 防止并发执行迁移, 锁与连接绑定, 所以在独立事务中持有
+//持锁期间迁移本身还需要另一个连接, db 配置的 max_open_conns 不能小于 2, 否则会一直等待连接
+func (this *Migrator) withLock(f func()) error { // {{{
+	return this.catch(func() {
+		this.init()
+
+		lock_name := "ygo_migrate:" + this.ConfName
+		conn := this.client.Begin(false)
+		defer conn.Rollback()
+
+		if "1" != conn.GetOne("select ifnull(get_lock(?, ?), 0)", lock_name, this.LockTimeout) {
+			panic("another migration is running: " + this.ConfName)
+		}
+
+		defer conn.GetOne("select ifnull(release_lock(?), 0)", lock_name)
+
+		f()
+	})
+} // }}}
+
+func (this *Migrator) catch(f func()) (err error) { // {{{
+	defer func() {
+		if e := recover(); e != nil {
+			if v, ok := e.(error); ok {
+				err = v
+			} else {
+				err = fmt.Errorf("%s", strings.TrimSpace(fmt.Sprint(e)))
+			}
+		}
+	}()
+
+	f()
+
+	return
+} // }}}
@@ -0,0 +1,108 @@
+package outbox
+
+import (
+	"fmt"
+	"github.com/mlaoji/ygo/x"
+	"github.com/mlaoji/ygo/x/db"
+	"strings"
+)
+
+//事务发件箱: 业务数据与待发送的事件在同一事务中写入, 由 Relay 异步投递到 Sink, 保证事件不丢失
+//表结构见 CreateTableSQL()
+var (
+	//默认使用的db配置名
+	DefaultConf = "db_master"
+	//发件箱表
+	TableName = "outbox"
+)
+
+//消息状态
+const (
+	STATUS_PENDING = 0 //待发送
+	STATUS_SENT    = 1 //已发送
+	STATUS_DEAD    = 2 //超过最大重试次数, 不再发送
+)
+
+const createTableSQL = "CREATE TABLE IF NOT EXISTS `%s` (\n" +
+	"  `id` bigint unsigned NOT NULL AUTO_INCREMENT,\n" +
+	"  `topic` varchar(128) NOT NULL DEFAULT '',\n" +
+	"  `msg_key` varchar(128) NOT NULL DEFAULT '' COMMENT '相同key的消息按顺序发送',\n" +
+	"  `payload` mediumtext,\n" +
+	"  `status` tinyint NOT NULL DEFAULT '0' COMMENT '0:待发送 1:已发送 2:失败',\n" +
+	"  `attempts` int NOT NULL DEFAULT '0',\n" +
+	"  `next_at` datetime NOT NULL COMMENT '下次发送时间',\n" +
+	"  `last_error` varchar(512) NOT NULL DEFAULT '',\n" +
+	"  `created_at` datetime NOT NULL,\n" +
+	"  `sent_at` datetime DEFAULT NULL,\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  KEY `idx_status_next` (`status`,`next_at`),\n" +
+	"  KEY `idx_key` (`msg_key`,`status`,`id`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+//建表语句, 可在迁移文件中使用
+func CreateTableSQL() string { // {{{
+	return fmt.Sprintf(createTableSQL, TableName)
+} // }}}
+
+//发件箱中的一条消息
+type Message struct {
+	Id        int
+	Topic     string
+	Key       string
+	Payload   string
+	Attempts  int //已尝试发送的次数(不含本次)
+	CreatedAt string
+}
+
+//在事务中写入一条待发送的消息, 返回消息id, 事务提交后由 Relay 发送, 回滚则不发送
+//payload 为string或[]byte时原样保存, 其他类型保存为json; key 不为空时相同key的消息按写入顺序发送
+//如:
+//	tx := tx.TransBegin()
+//	defer tx.Rollback()
+//	uid := dao.NewDAOUser(tx).AddRecord(user)
+//	outbox.Publish(tx, "user.created", x.ToString(uid), user)
+//	tx.Commit()
+func Publish(tx db.DBClient, topic, key string, payload interface{}) int { // {{{
+	now := x.DateTime()
+
+	return tx.Insert(TableName, map[string]interface{}{
+		"topic":      topic,
+		"msg_key":    key,
+		"payload":    encodePayload(payload),
+		"status":     STATUS_PENDING,
+		"next_at":    now,
+		"created_at": now,
+	})
+} // }}}
+
+//将失败(STATUS_DEAD)的消息重新置为待发送, ids 为空时重置全部
+func Retry(conf_name string, ids ...interface{}) int { // {{{
+	if "" == conf_name {
+		conf_name = DefaultConf
+	}
+
+	where := "status=?"
+	values := []interface{}{STATUS_DEAD}
+	if len(ids) > 0 {
+		where += " and id in (?" + strings.Repeat(",?", len(ids)-1) + ")"
+		values = append(values, ids...)
+	}
+
+	return x.DB.Get(conf_name).Update(TableName, map[string]interface{}{
+		"status":     STATUS_PENDING,
+		"attempts":   0,
+		"next_at":    x.DateTime(),
+		"last_error": "",
+	}, where, values...)
+} // }}}
+
+func encodePayload(payload interface{}) string { // {{{
+	switch val := payload.(type) {
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	}
+
+	return x.JsonEncode(payload)
+} // }}}
@@ -0,0 +1,230 @@
+package outbox
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mlaoji/ygo/x"
+	"github.com/mlaoji/ygo/x/db"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+func NewRelay(conf_name string, options ...FuncRelayOption) *Relay { // {{{
+	if "" == conf_name {
+		conf_name = DefaultConf
+	}
+
+	r := &Relay{
+		ConfName:    conf_name,
+		BatchSize:   100,
+		Interval:    time.Second,
+		MaxAttempts: 10,
+		Backoff:     DefaultBackoff,
+		stop:        make(chan struct{}),
+	}
+
+	for _, opt := range options {
+		opt(r)
+	}
+
+	return r
+} // }}}
+
+type FuncRelayOption func(r *Relay)
+
+//NewRelay 设置参数 BatchSize, 每次读取的消息数
+func WithBatchSize(size int) FuncRelayOption { // {{{
+	return func(r *Relay) {
+		if size > 0 {
+			r.BatchSize = size
+		}
+	}
+} // }}}
+
+//NewRelay 设置参数 Interval, 没有待发送消息时的轮询间隔
+func WithInterval(interval time.Duration) FuncRelayOption { // {{{
+	return func(r *Relay) {
+		if interval > 0 {
+			r.Interval = interval
+		}
+	}
+} // }}}
+
+//NewRelay 设置参数 MaxAttempts, 超过后消息标记为失败(STATUS_DEAD), 相同key的后续消息继续发送, 失败的消息可通过 Retry 重新发送
+func WithMaxAttempts(n int) FuncRelayOption { // {{{
+	return func(r *Relay) {
+		if n > 0 {
+			r.MaxAttempts = n
+		}
+	}
+} // }}}
+
+//NewRelay 设置参数 Backoff, 第n次失败后的重试间隔
+func WithBackoff(backoff func(attempts int) time.Duration) FuncRelayOption { // {{{
+	return func(r *Relay) {
+		if nil != backoff {
+			r.Backoff = backoff
+		}
+	}
+} // }}}
+
+//默认重试间隔: 2^n 秒, 最长1小时
+func DefaultBackoff(attempts int) time.Duration { // {{{
+	if attempts > 12 {
+		return time.Hour
+	}
+
+	d := time.Duration(1<<uint(attempts)) * time.Second
+	if d > time.Hour {
+		d = time.Hour
+	}
+
+	return d
+} // }}}
+
+//从发件箱读取待发送的消息并投递到 Sink
+//相同key的消息按id顺序发送, 前一条未发送成功时后面的消息等待; 多个 Relay 同时运行时通过 mysql GET_LOCK 保证只有一个在发送
+type Relay struct {
+	ConfName    string
+	BatchSize   int
+	Interval    time.Duration
+	MaxAttempts int
+	Backoff     func(attempts int) time.Duration
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	client   db.DBClient
+}
+
+var ErrNoSink = errors.New("outbox sink not found")
+
+//持续发送, 直到调用 Stop
+func (this *Relay) Run() { // {{{
+	for {
+		sent, failed, err := this.RunOnce()
+		if err != nil {
+			x.Logger.Warn("outbox relay error:", err)
+		}
+
+		//本批次已满时立即读取下一批
+		if nil == err && sent+failed >= this.BatchSize {
+			select {
+			case <-this.stop:
+				return
+			default:
+				continue
+			}
+		}
+
+		select {
+		case <-this.stop:
+			return
+		case <-time.After(this.Interval):
+		}
+	}
+} // }}}
+
+//停止 Run, 当前批次发送完成后返回
+func (this *Relay) Stop() { // {{{
+	this.stopOnce.Do(func() {
+		close(this.stop)
+	})
+} // }}}
+
+//发送一批消息, 返回发送成功及失败的数量
+func (this *Relay) RunOnce() (sent, failed int, err error) { // {{{
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+
+	if nil == this.client {
+		this.client = x.DB.Get(this.ConfName)
+	}
+
+	lock_name := "ygo_outbox:" + this.ConfName + ":" + TableName
+	conn := this.client.Begin(false)
+	defer conn.Rollback()
+
+	if "1" != conn.GetOne("select ifnull(get_lock(?, 0), 0)", lock_name) {
+		return
+	}
+	defer conn.GetOne("select release_lock(?)", lock_name)
+
+	//同一key存在更早的待发送消息时跳过, 保证按key顺序发送
+	list := this.client.GetAll("select id,topic,msg_key,payload,attempts,created_at from "+TableName+" o where status=? and next_at<=? "+
+		"and (msg_key='' or not exists (select 1 from "+TableName+" p where p.msg_key=o.msg_key and p.status=? and p.id<o.id)) "+
+		"order by id limit "+x.ToString(this.BatchSize), STATUS_PENDING, x.DateTime(), STATUS_PENDING)
+
+	blocked := map[string]bool{}
+	for _, row := range list {
+		m := &Message{
+			Id:        x.AsInt(row["id"]),
+			Topic:     x.AsString(row["topic"]),
+			Key:       x.AsString(row["msg_key"]),
+			Payload:   x.AsString(row["payload"]),
+			Attempts:  x.AsInt(row["attempts"]),
+			CreatedAt: x.AsString(row["created_at"]),
+		}
+
+		if "" != m.Key && blocked[m.Key] {
+			continue
+		}
+
+		if e := this.send(m); e != nil {
+			failed++
+			if "" != m.Key {
+				blocked[m.Key] = true
+			}
+
+			this.fail(m, e)
+			continue
+		}
+
+		sent++
+		this.client.Update(TableName, map[string]interface{}{"status": STATUS_SENT, "attempts": m.Attempts + 1, "sent_at": x.DateTime()}, "id=?", m.Id)
+	}
+
+	return
+} // }}}
+
+func (this *Relay) send(m *Message) (err error) { // {{{
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+
+	sink := getSink(m.Topic)
+	if nil == sink {
+		return ErrNoSink
+	}
+
+	return sink.Send(m)
+} // }}}
+
+func (this *Relay) fail(m *Message, err error) { // {{{
+	attempts := m.Attempts + 1
+	errmsg := err.Error()
+	if len(errmsg) > 512 {
+		//按字符边界截断, 避免写入不完整的 utf8 字符
+		n := 512
+		for n > 0 && !utf8.RuneStart(errmsg[n]) {
+			n--
+		}
+		errmsg = errmsg[:n]
+	}
+
+	vals := map[string]interface{}{"attempts": attempts, "last_error": errmsg}
+	if attempts >= this.MaxAttempts {
+		vals["status"] = STATUS_DEAD
+	} else {
+		vals["next_at"] = x.DateTime(x.Now() + int(this.Backoff(attempts)/time.Second))
+	}
+
+	this.client.Update(TableName, vals, "id=?", m.Id)
+
+	x.Logger.Warn("outbox send error:", m.Id, m.Topic, m.Key, attempts, errmsg)
+} // }}}
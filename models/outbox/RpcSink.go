@@ -0,0 +1,98 @@
+//go:build !norpc
+// +build !norpc
+
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mlaoji/ygo/x"
+	"github.com/mlaoji/ygo/x/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"sync"
+	"time"
+)
+
+//按地址复用的 rpc 连接, 连接断开时由 grpc 自动重连
+var (
+	rpcConns     = map[string]*grpc.ClientConn{}
+	rpcConnMutex sync.Mutex
+)
+
+func rpcConn(addr string) (*grpc.ClientConn, error) { // {{{
+	rpcConnMutex.Lock()
+	defer rpcConnMutex.Unlock()
+
+	if conn, ok := rpcConns[addr]; ok {
+		return conn, nil
+	}
+
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+
+	rpcConns[addr] = conn
+
+	return conn, nil
+} // }}}
+
+//调用 ygo rpc 服务的接口, 参数: id, topic, key, payload; 返回的code不为0时视为失败
+//同一地址的 RpcSink 共用一个连接
+type RpcSink struct {
+	Addr    string //如: 127.0.0.1:9002
+	Method  string //如: event/receive
+	Appid   string //rpc_auth 鉴权
+	Secret  string
+	Timeout int //超时时间, 单位:秒, 默认5
+}
+
+func (this *RpcSink) Send(m *Message) error { // {{{
+	timeout := this.Timeout
+	if timeout <= 0 {
+		timeout = 5
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	conn, err := rpcConn(this.Addr)
+	if err != nil {
+		return err
+	}
+
+	if "" != this.Appid {
+		ctx = metadata.AppendToOutgoingContext(ctx, "appid", this.Appid, "secret", this.Secret)
+	}
+
+	reply, err := pb.NewYGOServiceClient(conn).Call(ctx, &pb.Request{
+		Method: this.Method,
+		Params: map[string]string{
+			"id":      x.ToString(m.Id),
+			"topic":   m.Topic,
+			"key":     m.Key,
+			"payload": m.Payload,
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	ret := struct {
+		Code int         `json:"code"`
+		Msg  interface{} `json:"msg"`
+	}{}
+
+	if err = json.Unmarshal(reply.GetResponse(), &ret); err != nil {
+		return fmt.Errorf("invalid rpc response: %s", reply.GetResponse())
+	}
+
+	if 0 != ret.Code {
+		return fmt.Errorf("rpc error %d: %v", ret.Code, ret.Msg)
+	}
+
+	return nil
+} // }}}
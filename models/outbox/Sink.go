@@ -0,0 +1,133 @@
+package outbox
+
+import (
+	"fmt"
+	"github.com/mlaoji/ygo/x"
+	"net/http"
+	"sync"
+)
+
+//消息投递目标, Send 返回错误时消息会按退避策略重试
+type Sink interface {
+	Send(m *Message) error
+}
+
+//函数形式的 Sink
+type SinkFunc func(m *Message) error
+
+func (f SinkFunc) Send(m *Message) error {
+	return f(m)
+}
+
+var (
+	sinks     = map[string]Sink{}
+	sinkMutex sync.RWMutex
+)
+
+//注册 topic 对应的 Sink, topic 为 "*" 时作为未注册 topic 的默认 Sink, 一般在 init 中调用
+func RegisterSink(topic string, sink Sink) { // {{{
+	sinkMutex.Lock()
+	defer sinkMutex.Unlock()
+
+	sinks[topic] = sink
+} // }}}
+
+func getSink(topic string) Sink { // {{{
+	sinkMutex.RLock()
+	defer sinkMutex.RUnlock()
+
+	if sink, ok := sinks[topic]; ok {
+		return sink
+	}
+
+	return sinks["*"]
+} // }}}
+
+//写入 redis list(rpush), Key 为空时使用 topic
+type RedisListSink struct {
+	Redis string //redis 配置名
+	Key   string
+}
+
+func (this *RedisListSink) Send(m *Message) error { // {{{
+	rds, err := x.NewRedis(this.Redis)
+	if err != nil {
+		return err
+	}
+
+	key := this.Key
+	if "" == key {
+		key = m.Topic
+	}
+
+	return rds.Rpush(key, m.Payload)
+} // }}}
+
+//写入 redis stream(xadd), Stream 为空时使用 topic, MaxLen 大于0时近似裁剪(MAXLEN ~)
+//字段: id, topic, key, payload
+type RedisStreamSink struct {
+	Redis  string //redis 配置名
+	Stream string
+	MaxLen int
+}
+
+func (this *RedisStreamSink) Send(m *Message) error { // {{{
+	rds, err := x.NewRedis(this.Redis)
+	if err != nil {
+		return err
+	}
+
+	stream := this.Stream
+	if "" == stream {
+		stream = m.Topic
+	}
+
+	args := []interface{}{stream}
+	if this.MaxLen > 0 {
+		args = append(args, "MAXLEN", "~", this.MaxLen)
+	}
+	args = append(args, "*", "id", m.Id, "topic", m.Topic, "key", m.Key, "payload", m.Payload)
+
+	resp, err := rds.Call("XADD", args...)
+	if err != nil {
+		return err
+	}
+
+	return resp.Err
+} // }}}
+
+//以 POST 表单方式调用 webhook, 参数: id, topic, key, payload; 返回非2xx状态码视为失败
+type HttpSink struct {
+	Url     string
+	Headers http.Header
+	Timeout int //超时时间, 单位:秒, 默认5
+}
+
+func (this *HttpSink) Send(m *Message) error { // {{{
+	timeout := this.Timeout
+	if timeout <= 0 {
+		timeout = 5
+	}
+
+	headers := []http.Header{}
+	if nil != this.Headers {
+		headers = append(headers, this.Headers)
+	}
+
+	resp, err := x.NewHttpClient(timeout).Post(this.Url, map[string]interface{}{
+		"id":      m.Id,
+		"topic":   m.Topic,
+		"key":     m.Key,
+		"payload": m.Payload,
+	}, headers...)
+
+	if err != nil {
+		return err
+	}
+
+	if resp.GetCode() < 200 || resp.GetCode() >= 300 {
+		return fmt.Errorf("http status %d: %s", resp.GetCode(), resp.GetResponse())
+	}
+
+	return nil
+} // }}}
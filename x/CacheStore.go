@@ -0,0 +1,57 @@
+package x
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mlaoji/ygo/x/cache"
+	"sync"
+)
+
+var (
+	cacheStores     = map[string]cache.Store{}
+	cacheStoreMutex sync.Mutex
+)
+
+//按配置选择缓存实现, 业务代码只依赖 cache.Store, 切换缓存方式只需修改参数:
+//只有 local 时使用 LocalCache; 只有 redis_conf 时使用 redis; 两者都有时使用 LocalCache + redis 两级缓存
+//同一组参数返回同一实例, options 仅在首次创建两级缓存时生效; 两级缓存在服务退出时自动停止接收广播
+func NewCacheStore(local bool, redis_conf string, options ...cache.FuncTieredOption) (cache.Store, error) { // {{{
+	if local && nil == LocalCache {
+		return nil, errors.New("LocalCache 未初始化")
+	}
+
+	if "" == redis_conf {
+		if !local {
+			return nil, errors.New("cache store 未配置")
+		}
+
+		return cache.NewLocalStore(LocalCache), nil
+	}
+
+	cacheStoreMutex.Lock()
+	defer cacheStoreMutex.Unlock()
+
+	name := fmt.Sprint(local, ":", redis_conf)
+	if s, ok := cacheStores[name]; ok {
+		return s, nil
+	}
+
+	rds, err := NewRedis(redis_conf)
+	if nil != err {
+		return nil, err
+	}
+
+	var s cache.Store
+	rs := cache.NewRedisStore(rds, DEFAULT_TTL)
+	if local {
+		tiered := cache.NewTieredStore(LocalCache, rs, options...)
+		OnShutdown(tiered.Close)
+		s = tiered
+	} else {
+		s = rs
+	}
+
+	cacheStores[name] = s
+
+	return s, nil
+} // }}}
@@ -7,6 +7,13 @@ import (
 	"sync"
 )
 
+func init() {
+	//慢查询写入日志: slow_sql.log
+	db.SlowLogHandler = func(entry map[string]interface{}) {
+		Logger.Other("slow_sql", entry)
+	}
+}
+
 func NewDBProxy() *DBProxy {
 	return &DBProxy{c: map[string]db.DBClient{}}
 }
@@ -16,7 +23,7 @@ type DBProxy struct {
 	c     map[string]db.DBClient
 }
 
-func (this *DBProxy) add(conf_name string) { // {{{
+func (this *DBProxy) add(conf_name string) db.DBClient { // {{{
 	this.mutex.Lock()
 	defer this.mutex.Unlock()
 
@@ -32,7 +39,16 @@ func (this *DBProxy) add(conf_name string) { // {{{
 
 		switch dbt {
 		case "mysql":
-			dbClient, err = db.NewMysqlClient(conf["host"], conf["user"], conf["password"], conf["database"], conf["charset"], AsInt(conf["max_open_conns"]), AsInt(conf["max_idle_conns"]))
+			dbClient, err = db.NewMysqlClient(conf["host"], conf["user"], conf["password"], conf["database"], conf["charset"], AsInt(conf["max_open_conns"]), AsInt(conf["max_idle_conns"]),
+				db.WithConfName(conf_name),
+				db.WithSlowThreshold(AsInt(conf["slow_threshold"])),
+				db.WithSlowExplain(AsBool(conf["slow_explain"])),
+				db.WithQueryStats(AsBool(conf["query_stats"])),
+				db.WithQueryTimeout(AsInt(conf["query_timeout"])),
+				db.WithStmtCache(AsInt(conf["stmt_cache"])),
+				db.WithConnMaxLifetime(AsInt(conf["conn_max_lifetime"])),
+				db.WithConnMaxIdleTime(AsInt(conf["conn_max_idle_time"])),
+			)
 
 			if err != nil {
 				panic(fmt.Sprintf("mysql connect error: %v", err))
@@ -46,16 +62,34 @@ func (this *DBProxy) add(conf_name string) { // {{{
 		this.c[conf_name] = dbClient
 		fmt.Println("add db: ", conf_name, " type:", dbt, " ["+conf["host"]+"] #ID:"+dbClient.ID())
 	}
+
+	return this.c[conf_name]
 } // }}}
 
 func (this *DBProxy) Get(conf_name string) db.DBClient { // {{{
 	this.mutex.RLock()
-	if this.c[conf_name] == nil {
-		this.mutex.RUnlock()
-		this.add(conf_name)
+	client := this.c[conf_name]
+	this.mutex.RUnlock()
+
+	if client == nil {
+		client = this.add(conf_name)
+	}
+
+	return client
+} // }}}
+
+//替换(或添加)指定配置名的db, 返回原来的db(不存在时为nil), client 为nil时删除, 主要用于测试中使用 db.FakeClient
+//如: restore := x.DB.Set("db_master", db.NewFakeClient()); defer x.DB.Set("db_master", restore)
+func (this *DBProxy) Set(conf_name string, client db.DBClient) db.DBClient { // {{{
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	old := this.c[conf_name]
+	if nil == client {
+		delete(this.c, conf_name)
 	} else {
-		this.mutex.RUnlock()
+		this.c[conf_name] = client
 	}
 
-	return this.c[conf_name]
+	return old
 } // }}}
@@ -1,7 +1,10 @@
 package x
 
 import (
+	"fmt"
 	"github.com/mlaoji/ygo/x/cache"
+	"github.com/mlaoji/ygo/x/endless"
+	"os"
 	"time"
 )
 
@@ -23,5 +26,50 @@ func NewLocalCache() *cache.Cache { // {{{
 		}
 	}
 
-	return cache.NewCache(DEFAULT_TTL, CLEAN_INTERVAL)
+	//容量限制, 默认不限制
+	options := []cache.FuncCacheOption{
+		cache.WithMaxItems(Conf.GetInt("localcache_max_items")),
+		cache.WithMaxBytes(int64(Conf.GetInt("localcache_max_bytes"))),
+		cache.WithPolicy(Conf.Get("localcache_policy")),
+	}
+
+	c := cache.NewCache(DEFAULT_TTL, CLEAN_INTERVAL, options...)
+
+	//快照, 启动时加载, 使重启后缓存不为空; 保存见 AutoSaveLocalCache
+	if path := Conf.Get("localcache_snapshot"); "" != path {
+		loadSnapshot(c, path)
+	}
+
+	return c
+} // }}}
+
+//定时, 退出及 fork 子进程前保存快照, 由 ygo 以服务模式(http/rpc/tcp/ws)运行时调用
+//cli 等进程只加载快照, 避免覆盖服务进程保存的快照
+func AutoSaveLocalCache(c *cache.Cache) { // {{{
+	path := Conf.Get("localcache_snapshot")
+	if "" == path || nil == c {
+		return
+	}
+
+	c.AutoSnapshot(path, time.Duration(Conf.GetInt("localcache_snapshot_interval"))*time.Second)
+
+	save := func() {
+		if _, err := c.SaveSnapshot(path); nil != err {
+			Logger.Warn("localcache snapshot save error:", path, err)
+		}
+	}
+	OnShutdown(save)
+	endless.OnFork(save)
+} // }}}
+
+func loadSnapshot(c *cache.Cache, path string) { // {{{
+	n, err := c.LoadSnapshot(path)
+	if nil != err {
+		if !os.IsNotExist(err) {
+			Logger.Warn("localcache snapshot load error:", path, err)
+		}
+		return
+	}
+
+	fmt.Println("LocalCache snapshot loaded:", n)
 } // }}}
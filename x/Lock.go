@@ -0,0 +1,30 @@
+package x
+
+import (
+	"github.com/mlaoji/ygo/x/lock"
+	"github.com/mlaoji/ygo/x/redis"
+)
+
+var (
+	//分布式锁默认使用的redis配置名
+	DefaultLockRedis = "redis"
+)
+
+//通过redis配置名创建分布式锁, conf_names 为空时使用 DefaultLockRedis, 配置多个时使用 Redlock 模式
+func NewLock(key string, conf_names []string, options ...lock.FuncLockOption) (*lock.Mutex, error) { // {{{
+	if len(conf_names) == 0 {
+		conf_names = []string{DefaultLockRedis}
+	}
+
+	clients := make([]*redis.RedisClient, 0, len(conf_names))
+	for _, conf_name := range conf_names {
+		rc, err := NewRedis(conf_name)
+		if nil != err {
+			return nil, err
+		}
+
+		clients = append(clients, rc)
+	}
+
+	return lock.NewMulti(key, clients, options...), nil
+} // }}}
@@ -1,8 +1,14 @@
 package x
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"github.com/mlaoji/ygo/x/redis"
+	"io/ioutil"
+	"sort"
+	"strings"
 	"sync"
 )
 
@@ -10,38 +16,131 @@ func NewRedisProxy() *RedisProxy {
 	return &RedisProxy{c: map[string]*redis.RedisClient{}}
 }
 
+//按完整配置缓存 redis 客户端, 同一host不同密码、db、连接池大小等配置使用不同的客户端
 type RedisProxy struct {
 	mutex sync.RWMutex
 	c     map[string]*redis.RedisClient
 }
 
+//支持的配置项:
+//host, password, poolsize, timeout, read_timeout, write_timeout
+//username: redis 6 ACL 用户名
+//db: 数据库编号, 连接后执行 SELECT
+//client_name: 连接后执行 CLIENT SETNAME
+//mode: 部署模式 single(默认)/cluster/sentinel, cluster 与 sentinel 模式下 host 可配置逗号分隔的多个地址
+//master_name: sentinel 模式下的 master 名称
+//prefix: key前缀, 多个应用共用redis时用于区分key
+//codec: SetValue/GetValue 使用的编码方式, json(默认)/msgpack/gob 或通过 redis.RegisterCodec 注册的名字
+//tls: 是否使用TLS连接, tls_ca: CA证书文件, tls_cert/tls_key: 客户端证书, tls_server_name: 校验的服务器名, tls_skip_verify: 不校验服务器证书
 func (this *RedisProxy) Get(config map[string]string) (*redis.RedisClient, error) { //{{{
+	key := redisConfKey(config)
 	host := config["host"]
+
 	this.mutex.RLock()
-	if this.c[host] == nil {
-		this.mutex.RUnlock()
+	client := this.c[key]
+	this.mutex.RUnlock()
+
+	if client == nil {
 		this.mutex.Lock()
 		defer this.mutex.Unlock()
 
-		if this.c[host] == nil {
+		if client = this.c[key]; client == nil {
+			tls_conf, err := redisTLSConfig(config)
+			if nil != err {
+				fmt.Println("add redis error:", "[", host, "] :", err)
+				return nil, err
+			}
+
+			var codec redis.Codec
+			if name := config["codec"]; "" != name {
+				if codec = redis.GetCodec(name); nil == codec {
+					err = errors.New("unknown redis codec: " + name)
+					fmt.Println("add redis error:", "[", host, "] :", err)
+					return nil, err
+				}
+			}
+
 			rc, err := redis.NewRedisClient(host,
 				config["password"],
 				redis.WithTimeout(AsInt(config["timeout"])),
 				redis.WithReadTimeout(AsInt(config["read_timeout"])),
 				redis.WithWriteTimeout(AsInt(config["write_timeout"])),
 				redis.WithPoolsize(AsInt(config["poolsize"])),
+				redis.WithUsername(config["username"]),
+				redis.WithDb(AsInt(config["db"])),
+				redis.WithTLS(tls_conf),
+				redis.WithClientName(config["client_name"]),
+				redis.WithMode(config["mode"]),
+				redis.WithMasterName(config["master_name"]),
+				redis.WithPrefix(config["prefix"]),
+				redis.WithCodec(codec),
 			)
 			if nil != err {
 				fmt.Println("add redis error:", "[", host, "] :", err)
 				return nil, err
 			}
 
-			this.c[host] = rc
-			fmt.Println("add redis :", "[", host, "]")
+			this.c[key] = rc
+			client = rc
+			fmt.Println("add redis :", "[", host, "] db:", rc.Db)
 		}
-	} else {
-		this.mutex.RUnlock()
 	}
 
-	return this.c[host], nil
+	return client, nil
+} // }}}
+
+//按排序后的全部配置项生成key
+func redisConfKey(config map[string]string) string { // {{{
+	keys := make([]string, 0, len(config))
+	for k := range config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	items := make([]string, 0, len(keys))
+	for _, k := range keys {
+		items = append(items, k+"="+config[k])
+	}
+
+	return strings.Join(items, "&")
+} // }}}
+
+func redisTLSConfig(config map[string]string) (*tls.Config, error) { // {{{
+	if !AsBool(config["tls"]) {
+		return nil, nil
+	}
+
+	conf := &tls.Config{
+		ServerName:         config["tls_server_name"],
+		InsecureSkipVerify: AsBool(config["tls_skip_verify"]),
+	}
+
+	if "" == conf.ServerName {
+		conf.ServerName = strings.Split(config["host"], ":")[0]
+	}
+
+	if ca := config["tls_ca"]; "" != ca {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("invalid tls_ca: " + ca)
+		}
+
+		conf.RootCAs = pool
+	}
+
+	if cert := config["tls_cert"]; "" != cert {
+		pair, err := tls.LoadX509KeyPair(cert, config["tls_key"])
+		if err != nil {
+			return nil, err
+		}
+
+		conf.Certificates = []tls.Certificate{pair}
+	}
+
+	return conf, nil
 } // }}}
@@ -120,12 +120,10 @@ func (this *Restrict) incrRecord(uniqid string) (times int) { //{{{
 	key := this.getKey(uniqid)
 
 	if this.redis != nil {
-		times, err = this.redis.Incr(key)
+		times, err = this.redis.IncrExpire(key, 1, this.Interval)
 		if nil != err {
 			return 0
 		}
-
-		this.redis.Expire(key, this.Interval)
 	} else {
 		ts, err := LocalCache.Incr(key, 1)
 		if nil != err {
@@ -0,0 +1,41 @@
+package x
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	shutdownHooks []func()
+	shutdownMutex sync.Mutex
+	shutdownOnce  sync.Once
+)
+
+//注册服务退出前执行的函数(如停止订阅, 停止后台任务), 按注册的相反顺序执行
+func OnShutdown(fn func()) { // {{{
+	shutdownMutex.Lock()
+	defer shutdownMutex.Unlock()
+
+	shutdownHooks = append(shutdownHooks, fn)
+} // }}}
+
+//执行 OnShutdown 注册的函数, 由 ygo 在服务退出时调用, 只执行一次
+func Shutdown() { // {{{
+	shutdownOnce.Do(func() {
+		shutdownMutex.Lock()
+		hooks := shutdownHooks
+		shutdownMutex.Unlock()
+
+		for i := len(hooks) - 1; i >= 0; i-- {
+			func() {
+				defer func() {
+					if err := recover(); err != nil {
+						fmt.Println("shutdown hook error:", err)
+					}
+				}()
+
+				hooks[i]()
+			}()
+		}
+	})
+} // }}}
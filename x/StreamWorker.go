@@ -0,0 +1,353 @@
+package x
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mlaoji/ygo/x/redis"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+//消息中用于选择处理函数的字段
+var StreamTypeField = "type"
+
+//处理 stream 消息, 返回 error 或 panic 视为处理失败
+type StreamHandler func(msg *redis.StreamMessage) error
+
+//以消费组方式消费 redis stream, 按消息的 type 字段分发到注册的处理函数
+//处理成功后 XACK; 失败的消息保持未确认, 空闲超过 ClaimIdle 后被重新认领并重试; 处理次数超过 MaxRetries+1 次后写入死信 stream 并确认
+//用法:
+//  w, _ := x.NewStreamWorker("redis", "orders", "billing")
+//  w.Handle("paid", func(msg *redis.StreamMessage) error { ... })
+//  w.HandleCli("refund", &cli.OrderController{}, "refund")
+//  go w.Run()
+//  ...
+//  w.Stop()
+func NewStreamWorker(conf_name, stream, group string, options ...FuncStreamWorkerOption) (*StreamWorker, error) { // {{{
+	rds, err := NewRedis(conf_name)
+	if nil != err {
+		return nil, err
+	}
+
+	host, _ := os.Hostname()
+
+	w := &StreamWorker{
+		Stream:      stream,
+		Group:       group,
+		Consumer:    fmt.Sprint(host, "-", os.Getpid()),
+		Concurrency: 1,
+		BatchSize:   10,
+		Block:       5 * time.Second,
+		MaxRetries:  3,
+		ClaimIdle:   30 * time.Second,
+		DeadLetter:  stream + ":dead",
+		StartId:     "0",
+		redis:       rds,
+		handlers:    map[string]StreamHandler{},
+		stop:        make(chan struct{}),
+	}
+
+	for _, opt := range options {
+		opt(w)
+	}
+
+	return w, nil
+} // }}}
+
+type FuncStreamWorkerOption func(w *StreamWorker)
+
+//NewStreamWorker 设置参数 Consumer, 消费者名称, 默认为 主机名-进程id
+func WithStreamConsumer(consumer string) FuncStreamWorkerOption { // {{{
+	return func(w *StreamWorker) {
+		if "" != consumer {
+			w.Consumer = consumer
+		}
+	}
+} // }}}
+
+//NewStreamWorker 设置参数 Concurrency, 同时处理消息的协程数
+func WithStreamConcurrency(n int) FuncStreamWorkerOption { // {{{
+	return func(w *StreamWorker) {
+		if n > 0 {
+			w.Concurrency = n
+		}
+	}
+} // }}}
+
+//NewStreamWorker 设置参数 BatchSize, 每次读取的消息数
+func WithStreamBatchSize(size int) FuncStreamWorkerOption { // {{{
+	return func(w *StreamWorker) {
+		if size > 0 {
+			w.BatchSize = size
+		}
+	}
+} // }}}
+
+//NewStreamWorker 设置参数 MaxRetries, 处理失败后的最大重试次数
+func WithStreamMaxRetries(n int) FuncStreamWorkerOption { // {{{
+	return func(w *StreamWorker) {
+		if n >= 0 {
+			w.MaxRetries = n
+		}
+	}
+} // }}}
+
+//NewStreamWorker 设置参数 ClaimIdle, 未确认的消息空闲超过此时长后被重新认领, 即失败重试的间隔
+func WithStreamClaimIdle(idle time.Duration) FuncStreamWorkerOption { // {{{
+	return func(w *StreamWorker) {
+		if idle > 0 {
+			w.ClaimIdle = idle
+		}
+	}
+} // }}}
+
+//NewStreamWorker 设置参数 DeadLetter, 死信 stream 名称, 默认为 stream:dead, 为空时丢弃超过重试次数的消息
+func WithStreamDeadLetter(stream string) FuncStreamWorkerOption { // {{{
+	return func(w *StreamWorker) {
+		w.DeadLetter = stream
+	}
+} // }}}
+
+//NewStreamWorker 设置参数 StartId, 消费组不存在时创建消费组的起始消息id, 默认 "0" 从头消费已有的消息, "$" 只消费创建后的新消息
+func WithStreamStartId(id string) FuncStreamWorkerOption { // {{{
+	return func(w *StreamWorker) {
+		if "" != id {
+			w.StartId = id
+		}
+	}
+} // }}}
+
+type StreamWorker struct {
+	Stream      string
+	Group       string
+	Consumer    string
+	Concurrency int
+	BatchSize   int
+	Block       time.Duration
+	MaxRetries  int
+	ClaimIdle   time.Duration
+	DeadLetter  string
+	StartId     string
+
+	redis    *redis.RedisClient
+	mutex    sync.RWMutex
+	handlers map[string]StreamHandler
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+var ErrNoStreamHandler = errors.New("stream handler not found")
+
+//注册处理函数, msg_type 为 "*" 时处理所有未匹配的消息
+func (this *StreamWorker) Handle(msg_type string, fn StreamHandler) { // {{{
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.handlers[msg_type] = fn
+} // }}}
+
+//注册 cli controller 的方法作为处理函数, 消息的字段及 _id 作为请求参数, 与命令行方式调用相同
+func (this *StreamWorker) HandleCli(msg_type string, c interface{}, action string) { // {{{
+	ct := reflect.Indirect(reflect.ValueOf(c)).Type()
+	controller_name := strings.TrimSuffix(ct.Name(), "Controller")
+	action_name := strings.Title(action)
+
+	_, ok := reflect.PtrTo(ct).MethodByName(action_name + ACTION_SUFFIX)
+	Interceptor(ok, ERR_METHOD_INVALID, controller_name+"/"+action_name)
+
+	this.Handle(msg_type, func(msg *redis.StreamMessage) error {
+		params := url.Values{"_id": []string{msg.Id}}
+		for k, v := range msg.Values {
+			params.Set(k, v)
+		}
+
+		vc := reflect.New(ct)
+		vc.MethodByName("PrepareCli").Call([]reflect.Value{reflect.ValueOf(params), reflect.ValueOf(controller_name), reflect.ValueOf(action_name)})
+		vc.MethodByName("Init").Call(nil)
+		vc.MethodByName(action_name + ACTION_SUFFIX).Call(nil)
+
+		return nil
+	})
+} // }}}
+
+//持续消费, 直到调用 Stop; 返回前等待处理中的消息完成
+func (this *StreamWorker) Run() error { // {{{
+	if err := this.redis.XgroupCreate(this.Stream, this.Group, this.StartId, true); nil != err {
+		return err
+	}
+
+	jobs := make(chan *redis.StreamMessage)
+	for i := 0; i < this.Concurrency; i++ {
+		this.wg.Add(1)
+		go func() {
+			defer this.wg.Done()
+			for msg := range jobs {
+				this.process(msg)
+			}
+		}()
+	}
+
+	last_claim := time.Time{}
+	for {
+		select {
+		case <-this.stop:
+			close(jobs)
+			this.wg.Wait()
+			return nil
+		default:
+		}
+
+		var list []*redis.StreamMessage
+		var err error
+		if time.Since(last_claim) >= this.ClaimIdle/2 {
+			last_claim = time.Now()
+			list, err = this.claim()
+		} else {
+			list, err = this.redis.XreadGroup(this.Stream, this.Group, this.Consumer, ">", this.BatchSize, this.Block)
+			for _, msg := range list {
+				msg.Deliveries = 1
+			}
+		}
+
+		if nil != err {
+			Logger.Warn("stream worker read error:", this.Stream, this.Group, err)
+			select {
+			case <-this.stop:
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		for _, msg := range list {
+			jobs <- msg
+		}
+	}
+} // }}}
+
+//停止 Run, 不再读取新消息
+func (this *StreamWorker) Stop() { // {{{
+	this.stopOnce.Do(func() {
+		close(this.stop)
+	})
+} // }}}
+
+//认领空闲超过 ClaimIdle 的未确认消息(包括本消费者及已退出的消费者的), 超过重试次数的写入死信
+func (this *StreamWorker) claim() ([]*redis.StreamMessage, error) { // {{{
+	pending, err := this.redis.Xpending(this.Stream, this.Group, "-", "+", this.BatchSize*10)
+	if nil != err {
+		return nil, err
+	}
+
+	deliveries := map[string]int{}
+	ids := []string{}
+	for _, p := range pending {
+		if p.Idle < this.ClaimIdle {
+			continue
+		}
+
+		deliveries[p.Id] = p.Deliveries
+		ids = append(ids, p.Id)
+		if len(ids) >= this.BatchSize {
+			break
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	list, err := this.redis.Xclaim(this.Stream, this.Group, this.Consumer, this.ClaimIdle, ids...)
+	if nil != err {
+		return nil, err
+	}
+
+	claimed := map[string]bool{}
+	val := make([]*redis.StreamMessage, 0, len(list))
+	for _, msg := range list {
+		claimed[msg.Id] = true
+		msg.Deliveries = deliveries[msg.Id] + 1
+
+		//超过重试次数(如处理时进程崩溃导致未能记录失败)
+		if msg.Deliveries > this.MaxRetries+1 {
+			this.dead(msg, errors.New("max deliveries exceeded"))
+			continue
+		}
+
+		val = append(val, msg)
+	}
+
+	//已从 stream 中删除的消息无法处理, 直接确认
+	for _, id := range ids {
+		if !claimed[id] {
+			this.redis.Xack(this.Stream, this.Group, id)
+		}
+	}
+
+	return val, nil
+} // }}}
+
+func (this *StreamWorker) process(msg *redis.StreamMessage) { // {{{
+	err := this.handle(msg)
+	if nil == err {
+		this.redis.Xack(this.Stream, this.Group, msg.Id)
+		return
+	}
+
+	Logger.Warn("stream worker handle error:", this.Stream, this.Group, msg.Id, msg.Deliveries, err)
+
+	if msg.Deliveries > this.MaxRetries {
+		this.dead(msg, err)
+	}
+} // }}}
+
+func (this *StreamWorker) handle(msg *redis.StreamMessage) (err error) { // {{{
+	defer func() {
+		if e := recover(); e != nil {
+			if v, ok := e.(error); ok {
+				err = v
+			} else {
+				err = fmt.Errorf("%v", e)
+			}
+		}
+	}()
+
+	this.mutex.RLock()
+	fn, ok := this.handlers[msg.Values[StreamTypeField]]
+	if !ok {
+		fn, ok = this.handlers["*"]
+	}
+	this.mutex.RUnlock()
+
+	if !ok {
+		return ErrNoStreamHandler
+	}
+
+	return fn(msg)
+} // }}}
+
+//写入死信 stream 并确认, 死信中保留原消息的字段, 并附加 _id, _group, _deliveries, _error
+func (this *StreamWorker) dead(msg *redis.StreamMessage, err error) { // {{{
+	if "" != this.DeadLetter {
+		values := map[string]interface{}{}
+		for k, v := range msg.Values {
+			values[k] = v
+		}
+
+		values["_id"] = msg.Id
+		values["_group"] = this.Group
+		values["_deliveries"] = msg.Deliveries
+		values["_error"] = err.Error()
+
+		if _, e := this.redis.Xadd(this.DeadLetter, values); nil != e {
+			Logger.Warn("stream worker dead letter error:", this.DeadLetter, msg.Id, e)
+			return
+		}
+	}
+
+	this.redis.Xack(this.Stream, this.Group, msg.Id)
+} // }}}
@@ -471,6 +471,11 @@ func Now() int { // {{{
 	return int(time.Now().Unix())
 } // }}}
 
+//当前使用的时区, 由 TIME_ZONE 指定
+func GetLoc() *time.Location { // {{{
+	return getLoc()
+} // }}}
+
 func getLoc() *time.Location { // {{{
 	if TIME_ZONE == "Local" {
 		return time.Local
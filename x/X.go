@@ -39,6 +39,23 @@ func NewRedis(conf_name string) (*redis.RedisClient, error) { // {{{
 	return Redis.Get(config)
 } // }}}
 
+//通过配置文件名字创建redis订阅者, 错误记录到 warn 日志, 服务退出时自动停止
+func NewSubscriber(conf_name string, options ...redis.FuncSubOption) (*redis.Subscriber, error) { // {{{
+	rds, err := NewRedis(conf_name)
+	if nil != err {
+		return nil, err
+	}
+
+	options = append([]redis.FuncSubOption{redis.WithSubErrorHandler(func(err error) {
+		Logger.Warn("redis subscriber error:", conf_name, err)
+	})}, options...)
+
+	sub := rds.NewSubscriber(options...)
+	OnShutdown(sub.Stop)
+
+	return sub, nil
+} // }}}
+
 //方便直接从x引用
 type YamlTree = yaml.YamlTree
 type YamlNode = yaml.YamlNode
@@ -0,0 +1,229 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mlaoji/ygo/x/redis"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+)
+
+//广播消息类型
+const (
+	BROADCAST_DEL        = "del"        //删除 Keys
+	BROADCAST_DEL_PREFIX = "del_prefix" //删除以 Keys 中任一前缀开头的缓存
+	BROADCAST_DEL_TAG    = "del_tag"    //删除带有 Keys 中任一标签的缓存
+	BROADCAST_FLUSH      = "flush"      //清除所有缓存, 包括各命名空间的
+	BROADCAST_SET        = "set"        //设置 Keys[0] 为 Value
+)
+
+//当前实例的标识, 收到自己发出的广播时忽略
+var SenderId = fmt.Sprintf("%s-%d-%d", hostname(), os.Getpid(), rand.New(rand.NewSource(time.Now().UnixNano())).Int63())
+
+//广播消息, 以 json 格式发布
+type Message struct {
+	Op        string      `json:"op"`
+	Keys      []string    `json:"keys,omitempty"`
+	Value     interface{} `json:"value,omitempty"` //其他实例收到的是 json 解码后的值, 如 map[string]interface{}, float64
+	Ttl       *int64      `json:"ttl,omitempty"`   //过期时间, 单位毫秒, 为空时使用默认过期时间
+	Tags      []string    `json:"tags,omitempty"`
+	Namespace string      `json:"ns,omitempty"`
+	Sender    string      `json:"sender"`
+}
+
+//在本地执行并广播给其他实例, 未开启广播(PubSubOpen)时只在本地执行
+func (c *cache) Broadcast(msg *Message) error { // {{{
+	msg.Namespace = c.name
+	msg.Sender = SenderId
+	c.apply(msg)
+
+	if !PubSubOpen {
+		return nil
+	}
+
+	rc, err := c.janitor.getRedis()
+	if nil != err {
+		return err
+	}
+
+	return publish(rc, PubSubChannel, msg)
+} // }}}
+
+func publish(rc *redis.RedisClient, channel string, msg *Message) error { // {{{
+	data, err := json.Marshal(msg)
+	if nil != err {
+		return err
+	}
+
+	_, err = rc.Publish(channel, data)
+
+	return err
+} // }}}
+
+//删除缓存并广播
+func (c *cache) Invalidate(keys ...string) error { // {{{
+	return c.Broadcast(&Message{Op: BROADCAST_DEL, Keys: keys})
+} // }}}
+
+//按前缀删除缓存并广播
+func (c *cache) InvalidatePrefix(prefixes ...string) error { // {{{
+	return c.Broadcast(&Message{Op: BROADCAST_DEL_PREFIX, Keys: prefixes})
+} // }}}
+
+//按标签删除缓存并广播
+func (c *cache) InvalidateTag(tags ...string) error { // {{{
+	return c.Broadcast(&Message{Op: BROADCAST_DEL_TAG, Keys: tags})
+} // }}}
+
+//清除所有缓存(包括各命名空间的)并广播
+func (c *cache) InvalidateAll() error { // {{{
+	return c.Broadcast(&Message{Op: BROADCAST_FLUSH})
+} // }}}
+
+//设置缓存并广播, 其他实例收到的是 json 解码后的值
+func (c *cache) BroadcastSet(k string, v interface{}, td ...time.Duration) error { // {{{
+	return c.BroadcastSetTags(k, v, nil, td...)
+} // }}}
+
+//设置缓存并打上标签后广播, 同 SetTags
+func (c *cache) BroadcastSetTags(k string, v interface{}, tags []string, td ...time.Duration) error { // {{{
+	msg := &Message{Op: BROADCAST_SET, Keys: []string{k}, Value: v, Tags: tags}
+	if len(td) > 0 {
+		//广播的过期时间单位为毫秒, 不足1毫秒的按1毫秒, 避免变为0(不过期)
+		ttl := int64(td[0] / time.Millisecond)
+		if 0 == ttl && td[0] > 0 {
+			ttl = 1
+		}
+		msg.Ttl = &ttl
+	}
+
+	return c.Broadcast(msg)
+} // }}}
+
+func (c *cache) apply(msg *Message) { // {{{
+	switch msg.Op {
+	case BROADCAST_DEL:
+		for _, k := range msg.Keys {
+			c.Del(k)
+		}
+	case BROADCAST_DEL_PREFIX:
+		c.DelPrefix(msg.Keys...)
+	case BROADCAST_DEL_TAG:
+		c.DelTag(msg.Keys...)
+	case BROADCAST_FLUSH:
+		c.flushAll()
+	case BROADCAST_SET:
+		if len(msg.Keys) == 0 {
+			return
+		}
+
+		if nil != msg.Ttl {
+			c.SetTags(msg.Keys[0], msg.Value, msg.Tags, time.Duration(*msg.Ttl)*time.Millisecond)
+		} else {
+			c.SetTags(msg.Keys[0], msg.Value, msg.Tags)
+		}
+	}
+} // }}}
+
+//清除缓存及各命名空间的缓存
+func (c *cache) flushAll() { // {{{
+	c.Flush()
+
+	c.mu.RLock()
+	namespaces := make([]*Cache, 0, len(c.namespaces))
+	for _, ns := range c.namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	c.mu.RUnlock()
+
+	for _, ns := range namespaces {
+		ns.flushAll()
+	}
+} // }}}
+
+//处理收到的广播, 兼容旧版本直接发布key的消息
+func (c *cache) receive(payload string) { // {{{
+	msg := &Message{}
+	if err := json.Unmarshal([]byte(payload), msg); nil != err || "" == msg.Op {
+		c.Del(payload)
+		return
+	}
+
+	if SenderId == msg.Sender {
+		return
+	}
+
+	if target := c.resolve(msg.Namespace); nil != target {
+		target.apply(msg)
+	}
+} // }}}
+
+//按路径查找命名空间, 不存在时返回 nil
+func (c *cache) resolve(path string) *cache { // {{{
+	if "" == path {
+		return c
+	}
+
+	target := c
+	for _, name := range strings.Split(path, "/") {
+		target.mu.RLock()
+		ns, ok := target.namespaces[name]
+		target.mu.RUnlock()
+
+		if !ok {
+			return nil
+		}
+
+		target = ns.cache
+	}
+
+	return target
+} // }}}
+
+//订阅广播, 连接断开后自动重连
+func (j *janitor) runBroadcast(c *cache) { // {{{
+	//订阅使用独立连接, 连接池初始化失败不影响订阅
+	rc, err := redis.NewRedisClient(RedisConf["host"], RedisConf["password"], redis.WithPoolsize(1))
+	if nil != err {
+		log.Printf("cache broadcast redis err: %v\n", err)
+	}
+
+	j.sub = rc.NewSubscriber(redis.WithSubErrorHandler(func(err error) {
+		log.Printf("cache broadcast subscribe err: %v\n", err)
+	}))
+
+	j.sub.Subscribe(func(msg *redis.PubSubMessage) {
+		c.receive(msg.Message)
+	}, PubSubChannel)
+
+	j.sub.Start()
+
+	log.Println("go-cache start broadcast")
+} // }}}
+
+//发布广播使用的连接, 初始化失败时下次调用重试
+func (j *janitor) getRedis() (*redis.RedisClient, error) { // {{{
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if nil != j.rc {
+		return j.rc, nil
+	}
+
+	rc, err := redis.NewRedisClient(RedisConf["host"], RedisConf["password"])
+	if nil != err {
+		return nil, err
+	}
+
+	j.rc = rc
+
+	return rc, nil
+} // }}}
+
+func hostname() string { // {{{
+	host, _ := os.Hostname()
+	return host
+} // }}}
@@ -3,11 +3,10 @@ package cache
 import (
 	"context"
 	"fmt"
-	"github.com/mediocregopher/radix.v2/pubsub"
-	"github.com/mediocregopher/radix.v2/redis"
-	"log"
+	"github.com/mlaoji/ygo/x/redis"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -35,6 +34,12 @@ type wrapper struct {
 type Item struct {
 	Object     interface{}
 	Expiration int64
+
+	size   int64  //估算的内存占用
+	access int64  //最后访问时间
+	hits   uint32 //访问次数
+	fresh  int64  //GetOrLoad 设置了 stale 时的新鲜截止时间, 之后到 Expiration 之间返回旧值并后台刷新
+	tags   []string
 }
 
 //是否过期
@@ -47,23 +52,35 @@ func (item Item) IsExpired() bool { // {{{
 } // }}}
 
 type cache struct {
+	stats             Stats //放在首位保证 64 位原子操作对齐
 	defaultExpiration time.Duration
 	items             map[string]Item
 	mu                sync.RWMutex
 	janitor           *janitor
 	ctx               context.Context
 	cancel            context.CancelFunc
+	maxItems          int
+	maxBytes          int64
+	policy            string
+	onEvicted         func(k string, v interface{})
+	bytes             int64
+	namespaces        map[string]*Cache
+	flight            Group             //GetOrLoad 合并并发加载
+	negatives         map[string]Item   //GetOrLoad 缓存的加载错误
+	loads             map[string]uint64 //GetOrLoad 加载中的key及加载期间被删除的次数
+	refreshing        map[string]bool   //GetOrLoad 后台刷新中的key
+	tags              map[string]map[string]struct{}
+	name              string           //命名空间路径, 如 a/b
+	root              *cache           //命名空间所属的根缓存
+	pending           *snapshotPending //根缓存中记录的快照里尚未创建的命名空间的缓存
 }
 
 //初始化缓存实例，设置默认缓存过期时间, 缓存清理间隔时间
-func NewCache(defaultExpiration, cleanupInterval time.Duration) *Cache { // {{{
-	ctx, cancel := context.WithCancel(context.Background())
-	c := &cache{
-		defaultExpiration: defaultExpiration,
-		ctx:               ctx,
-		cancel:            cancel,
-		items:             map[string]Item{},
-	}
+//可选设置容量限制及淘汰策略, 如: NewCache(5*time.Minute, 30*time.Minute, WithMaxItems(10000), WithPolicy(POLICY_LFU))
+func NewCache(defaultExpiration, cleanupInterval time.Duration, options ...FuncCacheOption) *Cache { // {{{
+	c := newCache(defaultExpiration, options...)
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.pending = &snapshotPending{}
 
 	C := &Cache{c}
 	runJanitor(c, cleanupInterval)
@@ -72,6 +89,20 @@ func NewCache(defaultExpiration, cleanupInterval time.Duration) *Cache { // {{{
 	return C
 } // }}}
 
+func newCache(defaultExpiration time.Duration, options ...FuncCacheOption) *cache { // {{{
+	c := &cache{
+		defaultExpiration: defaultExpiration,
+		items:             map[string]Item{},
+		policy:            POLICY_LRU,
+	}
+
+	for _, opt := range options {
+		opt(c)
+	}
+
+	return c
+} // }}}
+
 func runJanitor(c *cache, ci time.Duration) { // {{{
 	j := &janitor{
 		Interval: ci,
@@ -84,35 +115,26 @@ func runJanitor(c *cache, ci time.Duration) { // {{{
 	}
 
 	if PubSubOpen {
-		go j.runBroadcast(c)
-
-		//监控广播redis, 有异常则重启
-		go func() {
-			for {
-				select {
-				case <-c.ctx.Done():
-					log.Println("restart broadcast")
-
-					c.ctx, c.cancel = context.WithCancel(context.Background())
-					j.runBroadcast(c)
-				}
-
-				time.Sleep(1 * time.Second)
-			}
-		}()
+		j.runBroadcast(c)
 	}
 } // }}}
 
 func stopJanitor(c *Cache) { // {{{
 	c.cancel()
+
+	if nil != c.janitor.sub {
+		c.janitor.sub.Stop()
+	}
 } // }}}
 
 //设置缓存，如果存在则替换，不存在则新增
 //过期时间= -1 则永不过期
 func (c *cache) Set(k string, v interface{}, td ...time.Duration) { // {{{
 	c.mu.Lock()
-	c.set(k, v, td...)
+	evicted := c.set(k, v, td...)
 	c.mu.Unlock()
+
+	c.evicted(evicted)
 } // }}}
 
 //新增缓存，存在则返回错误
@@ -124,9 +146,11 @@ func (c *cache) Add(k string, v interface{}, td ...time.Duration) error { // {{{
 		return fmt.Errorf("Item %s already exists", k)
 	}
 
-	c.set(k, v, td...)
+	evicted := c.set(k, v, td...)
 	c.mu.Unlock()
 
+	c.evicted(evicted)
+
 	return nil
 } // }}}
 
@@ -139,14 +163,23 @@ func (c *cache) Replace(k string, v interface{}, td ...time.Duration) error { //
 		return fmt.Errorf("Item %s doesn't exist", k)
 	}
 
-	c.set(k, v, td...)
+	evicted := c.set(k, v, td...)
 	c.mu.Unlock()
 
+	c.evicted(evicted)
+
 	return nil
 } // }}}
 
 // 不设置过期时间，则使用默认过期时间设置，0 则不过期
-func (c *cache) set(k string, v interface{}, td ...time.Duration) { // {{{
+// 超出容量时返回被淘汰的缓存, 由调用者在释放锁后通知 onEvicted
+func (c *cache) set(k string, v interface{}, td ...time.Duration) []evictedItem { // {{{
+	if len(c.tags) > 0 {
+		if old, found := c.items[k]; found {
+			c.untag(k, old.tags)
+		}
+	}
+
 	var t time.Duration
 	if len(td) > 0 {
 		t = td[0]
@@ -159,21 +192,68 @@ func (c *cache) set(k string, v interface{}, td ...time.Duration) { // {{{
 		e = time.Now().Add(t).UnixNano()
 	}
 
-	c.items[k] = Item{
+	if !c.bounded() {
+		c.items[k] = Item{
+			Object:     v,
+			Expiration: e,
+		}
+
+		return nil
+	}
+
+	item := Item{
 		Object:     v,
 		Expiration: e,
+		access:     time.Now().UnixNano(),
+		hits:       1,
+	}
+
+	if old, found := c.items[k]; found {
+		c.bytes -= old.size
+		item.hits = old.hits + 1
+	}
+
+	if c.maxBytes > 0 {
+		item.size = sizeOf(k, v)
+		c.bytes += item.size
 	}
+
+	c.items[k] = item
+
+	return c.evict(k)
 } // }}}
 
 //获取缓存、是否存在
 func (c *cache) Get(k string) (interface{}, bool) { // {{{
+	//有容量限制时需记录访问信息
+	if c.bounded() {
+		c.mu.Lock()
+		v, _, found := c.get(k)
+		if found {
+			c.touch(k)
+		}
+		c.mu.Unlock()
+		c.hit(found)
+
+		return v, found
+	}
+
 	c.mu.RLock()
 	v, _, found := c.get(k)
 	c.mu.RUnlock()
+	c.hit(found)
 
 	return v, found
 } // }}}
 
+func (c *cache) hit(found bool) { // {{{
+	if found {
+		atomic.AddUint64(&c.stats.Hits, 1)
+	} else {
+		atomic.AddUint64(&c.stats.Misses, 1)
+	}
+} // }}}
+
 //获取剩余时间，单位秒, 不存在：-2， 未设置有效期：-1
 func (c *cache) Ttl(k string) int64 { // {{{
 	c.mu.RLock()
@@ -340,23 +420,44 @@ func (c *cache) Decr(k string, ns ...interface{}) (interface{}, error) { // {{{
 //删除缓存
 func (c *cache) Del(k string) { // {{{
 	c.mu.Lock()
-	_, found := c.items[k]
+	item, found := c.items[k]
 	if found {
-		delete(c.items, k)
+		c.remove(k, item)
 	}
+	delete(c.negatives, k)
+	c.abortLoad(k)
 	c.mu.Unlock()
 } // }}}
 
-//删除过期缓存
+//删除过期缓存, 包括各命名空间的
 func (c *cache) DelExpired() { // {{{
+	var evicted []evictedItem
 	now := time.Now().UnixNano()
 	c.mu.Lock()
 	for k, v := range c.items {
 		if v.Expiration > 0 && now > v.Expiration {
-			delete(c.items, k)
+			c.remove(k, v)
+			if nil != c.onEvicted {
+				evicted = append(evicted, evictedItem{k, v.Object})
+			}
 		}
 	}
+	for k, v := range c.negatives {
+		if now > v.Expiration {
+			delete(c.negatives, k)
+		}
+	}
+	namespaces := make([]*Cache, 0, len(c.namespaces))
+	for _, ns := range c.namespaces {
+		namespaces = append(namespaces, ns)
+	}
 	c.mu.Unlock()
+
+	c.evicted(evicted)
+
+	for _, ns := range namespaces {
+		ns.DelExpired()
+	}
 } // }}}
 
 //返回所有缓存列表
@@ -380,23 +481,27 @@ func (c *cache) Items() map[string]Item { // {{{
 func (c *cache) Flush() { // {{{
 	c.mu.Lock()
 	c.items = map[string]Item{}
+	c.bytes = 0
+	c.negatives = nil
+	c.tags = nil
+	for k := range c.loads {
+		c.abortLoad(k)
+	}
 	c.mu.Unlock()
 } // }}}
 
-//分布式更新缓存, 发送一条广播消息, 订阅的客户端收到消息后更新
+//分布式删除缓存, 本地删除并广播给其他实例
+//Deprecated: 使用 Invalidate
 func (c *cache) FlushCache(key string) error { // {{{
-	//init redis
-	pub, err := c.janitor.getPubClient()
-	if nil != err {
-		return err
-	}
-
-	return pub.Cmd("PUBLISH", PubSubChannel, key).Err
+	return c.Invalidate(key)
 } // }}}
 
 type janitor struct { // {{{
 	Interval time.Duration
 	stop     chan bool
+	mu       sync.Mutex
+	rc       *redis.RedisClient
+	sub      *redis.Subscriber
 } // }}}
 
 func (j *janitor) runCleaner(c *cache) { // {{{
@@ -411,96 +516,3 @@ func (j *janitor) runCleaner(c *cache) { // {{{
 		}
 	}
 } // }}}
-
-func (j *janitor) runBroadcast(c *cache) { // {{{
-	sub, err := j.getSubClient()
-	if nil != err {
-		log.Printf("getSubClient err: %#v, context canceled\n", err)
-		c.cancel()
-		return
-	}
-
-	log.Println("go-cache start broadcast")
-
-	sub.Subscribe(PubSubChannel)
-
-	subChan := make(chan *pubsub.SubResp)
-
-	go func() {
-		for {
-			time.Sleep(1 * time.Second)
-			resv := sub.Receive()
-
-			if nil != resv.Err {
-				if resv.Timeout() {
-					continue
-				}
-
-				log.Printf("receive  err: %#v, context canceled\n", resv.Err)
-				c.cancel()
-				return
-			}
-
-			subChan <- resv
-
-			ping := sub.Ping()
-			if nil != ping.Err {
-				log.Printf("ping err: %#v, context canceled\n", ping.Err)
-				c.cancel()
-				return
-			}
-		}
-	}()
-
-	for {
-		select {
-		case msg, ok := <-subChan:
-			if !ok {
-				log.Println("subChan closed")
-				c.cancel()
-			}
-
-			if msg.Type == pubsub.Message {
-				key := msg.Message
-
-				//删除cache
-				c.Del(key)
-			}
-		case <-c.ctx.Done():
-			return
-		}
-	}
-} // }}}
-
-func (j *janitor) getPubClient() (*redis.Client, error) { // {{{
-	return j.getRedis()
-} // }}}
-
-func (j *janitor) getSubClient() (*pubsub.SubClient, error) { // {{{
-	sub, err := j.getRedis()
-
-	if nil != err {
-		return nil, err
-	}
-
-	return pubsub.NewSubClient(sub), nil
-} // }}}
-
-func (j *janitor) getRedis() (*redis.Client, error) { // {{{
-	host := RedisConf["host"]
-	pass := RedisConf["password"]
-
-	r, err := redis.DialTimeout("tcp", host, time.Second*30)
-	if nil != err {
-		return nil, err
-	}
-
-	if "" != pass {
-		if err = r.Cmd("AUTH", pass).Err; err != nil {
-			r.Close()
-			return nil, err
-		}
-	}
-
-	return r, nil
-} // }}}
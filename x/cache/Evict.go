@@ -0,0 +1,279 @@
+package cache
+
+import (
+	"reflect"
+	"time"
+)
+
+//淘汰策略
+const (
+	POLICY_LRU = "lru" //淘汰最久未访问的
+	POLICY_LFU = "lfu" //淘汰访问次数最少的
+)
+
+//每次淘汰时随机采样的数量, 越大越接近精确的 LRU/LFU, 开销也越大
+var EvictionSamples = 10
+
+type FuncCacheOption func(c *cache)
+
+//NewCache 设置参数 maxItems, 最大缓存数量, 超过时按淘汰策略删除, 0 为不限制
+func WithMaxItems(n int) FuncCacheOption { // {{{
+	return func(c *cache) {
+		if n >= 0 {
+			c.maxItems = n
+		}
+	}
+} // }}}
+
+//NewCache 设置参数 maxBytes, 近似的最大内存占用(按值的大小估算), 超过时按淘汰策略删除, 0 为不限制
+func WithMaxBytes(n int64) FuncCacheOption { // {{{
+	return func(c *cache) {
+		if n >= 0 {
+			c.maxBytes = n
+		}
+	}
+} // }}}
+
+//NewCache 设置参数 policy, 可选 POLICY_LRU(默认), POLICY_LFU
+func WithPolicy(policy string) FuncCacheOption { // {{{
+	return func(c *cache) {
+		if POLICY_LRU == policy || POLICY_LFU == policy {
+			c.policy = policy
+		}
+	}
+} // }}}
+
+//NewCache 设置参数 onEvicted, 缓存因容量限制被淘汰或过期被清理时调用
+func WithOnEvicted(fn func(k string, v interface{})) FuncCacheOption { // {{{
+	return func(c *cache) {
+		c.onEvicted = fn
+	}
+} // }}}
+
+//Namespace 设置参数 defaultExpiration, 默认过期时间
+func WithDefaultExpiration(d time.Duration) FuncCacheOption { // {{{
+	return func(c *cache) {
+		c.defaultExpiration = d
+	}
+} // }}}
+
+type evictedItem struct {
+	key    string
+	object interface{}
+}
+
+//获取或创建命名空间, 命名空间是独立的子缓存, 有各自的容量限制和默认过期时间, 过期清理由父缓存统一执行
+//已存在时 options 不生效; 未指定 WithDefaultExpiration 时使用父缓存的默认过期时间
+func (c *cache) Namespace(name string, options ...FuncCacheOption) *Cache { // {{{
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ns, ok := c.namespaces[name]; ok {
+		return ns
+	}
+
+	sub := newCache(c.defaultExpiration, options...)
+	sub.ctx, sub.cancel = c.ctx, c.cancel
+	sub.janitor = c.janitor
+	sub.name = name
+	sub.root = c
+	if nil != c.root {
+		sub.name = c.name + "/" + name
+		sub.root = c.root
+	}
+
+	if nil == c.namespaces {
+		c.namespaces = map[string]*Cache{}
+	}
+
+	ns := &Cache{sub}
+	c.namespaces[name] = ns
+
+	//加载快照中该命名空间的缓存, 新建的命名空间只能通过 c.namespaces 获取, 此时不会被其他协程使用
+	sub.loadPending()
+
+	return ns
+} // }}}
+
+//所有命名空间
+func (c *cache) Namespaces() map[string]*Cache { // {{{
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	m := make(map[string]*Cache, len(c.namespaces))
+	for name, ns := range c.namespaces {
+		m[name] = ns
+	}
+
+	return m
+} // }}}
+
+//缓存数量(包括已过期未清理的)
+func (c *cache) Len() int { // {{{
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.items)
+} // }}}
+
+//估算的内存占用, 仅设置了 maxBytes 时统计
+func (c *cache) Bytes() int64 { // {{{
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.bytes
+} // }}}
+
+//是否需要记录访问信息及淘汰
+func (c *cache) bounded() bool { // {{{
+	return c.maxItems > 0 || c.maxBytes > 0
+} // }}}
+
+//记录访问时间及次数, 需持有写锁
+func (c *cache) touch(k string) { // {{{
+	item, found := c.items[k]
+	if !found {
+		return
+	}
+
+	item.access = time.Now().UnixNano()
+	item.hits++
+	c.items[k] = item
+} // }}}
+
+//超出容量时淘汰, keep 为刚写入的key, 除非只剩它自己否则不淘汰; 需持有写锁
+func (c *cache) evict(keep string) []evictedItem { // {{{
+	var evicted []evictedItem
+	for (c.maxItems > 0 && len(c.items) > c.maxItems) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		k := c.sample(keep)
+		if "" == k {
+			k = keep
+		}
+
+		item, found := c.items[k]
+		if !found {
+			break
+		}
+
+		c.remove(k, item)
+		evicted = append(evicted, evictedItem{k, item.Object})
+	}
+
+	return evicted
+} // }}}
+
+//随机采样, 返回最应淘汰的key, 已过期的优先
+func (c *cache) sample(keep string) string { // {{{
+	now := time.Now().UnixNano()
+
+	var victim string
+	var worst Item
+	n := 0
+	for k, item := range c.items {
+		if k == keep {
+			continue
+		}
+
+		if item.Expiration > 0 && now > item.Expiration {
+			return k
+		}
+
+		if "" == victim || c.worse(item, worst) {
+			victim, worst = k, item
+		}
+
+		if n++; n >= EvictionSamples {
+			break
+		}
+	}
+
+	return victim
+} // }}}
+
+//a 是否比 b 更应被淘汰
+func (c *cache) worse(a, b Item) bool { // {{{
+	if POLICY_LFU == c.policy && a.hits != b.hits {
+		return a.hits < b.hits
+	}
+
+	return a.access < b.access
+} // }}}
+
+//删除并更新内存统计及标签, 需持有写锁
+func (c *cache) remove(k string, item Item) { // {{{
+	delete(c.items, k)
+	c.bytes -= item.size
+	c.untag(k, item.tags)
+} // }}}
+
+func (c *cache) evicted(list []evictedItem) { // {{{
+	if nil == c.onEvicted {
+		return
+	}
+
+	for _, e := range list {
+		c.onEvicted(e.key, e.object)
+	}
+} // }}}
+
+//估算值占用的内存, 只计算字符串, 切片, map 等的内容, 不精确
+func sizeOf(k string, v interface{}) int64 { // {{{
+	return int64(len(k)) + 64 + sizeOfValue(reflect.ValueOf(v), 3)
+} // }}}
+
+func sizeOfValue(v reflect.Value, depth int) int64 { // {{{
+	if !v.IsValid() {
+		return 0
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Len()) + 16
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return 8
+		}
+
+		return 8 + sizeOfValue(v.Elem(), depth)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return int64(v.Len()) + 24
+		}
+
+		size := int64(24)
+		if depth <= 0 {
+			return size + int64(v.Len())*int64(v.Type().Elem().Size())
+		}
+
+		for i := 0; i < v.Len(); i++ {
+			size += sizeOfValue(v.Index(i), depth-1)
+		}
+
+		return size
+	case reflect.Map:
+		size := int64(48)
+		if depth <= 0 {
+			return size + int64(v.Len())*int64(v.Type().Key().Size()+v.Type().Elem().Size())
+		}
+
+		iter := v.MapRange()
+		for iter.Next() {
+			size += sizeOfValue(iter.Key(), depth-1) + sizeOfValue(iter.Value(), depth-1)
+		}
+
+		return size
+	case reflect.Struct:
+		if depth <= 0 {
+			return int64(v.Type().Size())
+		}
+
+		size := int64(0)
+		for i := 0; i < v.NumField(); i++ {
+			size += sizeOfValue(v.Field(i), depth-1)
+		}
+
+		return size
+	}
+
+	return int64(v.Type().Size())
+} // }}}
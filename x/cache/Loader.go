@@ -0,0 +1,225 @@
+package cache
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+//命中统计
+type Stats struct {
+	Hits         uint64 //命中(不含过期后返回旧值的)
+	Misses       uint64 //未命中
+	StaleHits    uint64 //GetOrLoad 过期后返回旧值并后台刷新
+	NegativeHits uint64 //GetOrLoad 命中缓存的加载错误
+	Loads        uint64 //GetOrLoad 调用 loader 的次数
+	LoadErrors   uint64 //loader 返回错误或 panic 的次数
+}
+
+type loadOption struct {
+	stale       time.Duration
+	negativeTTL time.Duration
+}
+
+type FuncLoadOption func(o *loadOption)
+
+//GetOrLoad 设置参数 stale, 过期后 stale 时间内仍返回旧值, 同时在后台重新加载
+func WithStale(d time.Duration) FuncLoadOption { // {{{
+	return func(o *loadOption) {
+		if d > 0 {
+			o.stale = d
+		}
+	}
+} // }}}
+
+//GetOrLoad 设置参数 negativeTTL, loader 返回错误时缓存该错误的时间, 期间直接返回该错误而不再调用 loader
+func WithNegativeTTL(d time.Duration) FuncLoadOption { // {{{
+	return func(o *loadOption) {
+		if d > 0 {
+			o.negativeTTL = d
+		}
+	}
+} // }}}
+
+//获取缓存, 不存在时调用 loader 加载并以 ttl 缓存(ttl 为0时使用默认过期时间, -1 则永不过期)
+//同一key的并发加载只调用一次 loader, 其余调用等待并共享结果
+//用法:
+//  v, err := x.LocalCache.GetOrLoad("user:1", time.Minute, func() (interface{}, error) {
+//      return loadUser(1)
+//  }, cache.WithStale(10*time.Second), cache.WithNegativeTTL(5*time.Second))
+func (c *cache) GetOrLoad(k string, ttl time.Duration, loader func() (interface{}, error), options ...FuncLoadOption) (interface{}, error) { // {{{
+	opt := &loadOption{}
+	for _, o := range options {
+		o(opt)
+	}
+
+	item, found, err := c.lookup(k)
+	if nil != err {
+		atomic.AddUint64(&c.stats.NegativeHits, 1)
+		return nil, err
+	}
+
+	if found {
+		if item.fresh > 0 && time.Now().UnixNano() > item.fresh {
+			atomic.AddUint64(&c.stats.StaleHits, 1)
+
+			//同一key同时只有一个后台刷新
+			c.mu.Lock()
+			refreshing := c.refreshing[k]
+			if !refreshing {
+				if nil == c.refreshing {
+					c.refreshing = map[string]bool{}
+				}
+				c.refreshing[k] = true
+			}
+			c.mu.Unlock()
+
+			if !refreshing {
+				go c.refresh(k, ttl, loader, opt)
+			}
+		} else {
+			atomic.AddUint64(&c.stats.Hits, 1)
+		}
+
+		return item.Object, nil
+	}
+
+	atomic.AddUint64(&c.stats.Misses, 1)
+
+	v, err, _ := c.flight.Do(k, func() (interface{}, error) {
+		return c.load(k, ttl, loader, opt)
+	})
+
+	return v, err
+} // }}}
+
+//命中统计
+func (c *cache) Stats() Stats { // {{{
+	return Stats{
+		Hits:         atomic.LoadUint64(&c.stats.Hits),
+		Misses:       atomic.LoadUint64(&c.stats.Misses),
+		StaleHits:    atomic.LoadUint64(&c.stats.StaleHits),
+		NegativeHits: atomic.LoadUint64(&c.stats.NegativeHits),
+		Loads:        atomic.LoadUint64(&c.stats.Loads),
+		LoadErrors:   atomic.LoadUint64(&c.stats.LoadErrors),
+	}
+} // }}}
+
+//查找缓存及缓存的加载错误
+func (c *cache) lookup(k string) (Item, bool, error) { // {{{
+	if c.bounded() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+	} else {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+	}
+
+	now := time.Now().UnixNano()
+	if item, found := c.items[k]; found && (0 == item.Expiration || now <= item.Expiration) {
+		if c.bounded() {
+			c.touch(k)
+		}
+
+		return item, true, nil
+	}
+
+	if item, found := c.negatives[k]; found && now <= item.Expiration {
+		return Item{}, false, item.Object.(error)
+	}
+
+	return Item{}, false, nil
+} // }}}
+
+//后台刷新, 失败时保留旧值
+func (c *cache) refresh(k string, ttl time.Duration, loader func() (interface{}, error), opt *loadOption) { // {{{
+	defer func() {
+		recover()
+
+		c.mu.Lock()
+		delete(c.refreshing, k)
+		c.mu.Unlock()
+	}()
+
+	c.flight.Do(k, func() (interface{}, error) {
+		//等待期间已被其他加载刷新
+		c.mu.RLock()
+		item, found := c.items[k]
+		c.mu.RUnlock()
+		if found && item.fresh > 0 && time.Now().UnixNano() <= item.fresh {
+			return item.Object, nil
+		}
+
+		return c.load(k, ttl, loader, &loadOption{stale: opt.stale})
+	})
+} // }}}
+
+//GetOrLoad 加载期间删除了该key, 加载结果不再写入缓存, 需持有写锁
+func (c *cache) abortLoad(k string) { // {{{
+	if _, found := c.loads[k]; found {
+		c.loads[k]++
+	}
+} // }}}
+
+func (c *cache) load(k string, ttl time.Duration, loader func() (interface{}, error), opt *loadOption) (v interface{}, err error) { // {{{
+	atomic.AddUint64(&c.stats.Loads, 1)
+
+	//同一key的加载通过 flight 合并, 同时只有一个
+	c.mu.Lock()
+	if nil == c.loads {
+		c.loads = map[string]uint64{}
+	}
+	c.loads[k] = 0
+	c.mu.Unlock()
+
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("cache loader panic: %v", e)
+		}
+
+		c.mu.Lock()
+		if nil != err {
+			atomic.AddUint64(&c.stats.LoadErrors, 1)
+			if opt.negativeTTL > 0 && 0 == c.loads[k] {
+				if nil == c.negatives {
+					c.negatives = map[string]Item{}
+				}
+				c.negatives[k] = Item{Object: err, Expiration: time.Now().Add(opt.negativeTTL).UnixNano()}
+			}
+		}
+		delete(c.loads, k)
+		c.mu.Unlock()
+	}()
+
+	v, err = loader()
+	if nil != err {
+		return nil, err
+	}
+
+	if 0 == ttl {
+		ttl = c.defaultExpiration
+	}
+
+	hard := ttl
+	if ttl > 0 && opt.stale > 0 {
+		hard = ttl + opt.stale
+	}
+
+	c.mu.Lock()
+	if 0 != c.loads[k] {
+		c.mu.Unlock()
+		return v, nil
+	}
+
+	delete(c.negatives, k)
+	evicted := c.set(k, v, hard)
+	if item, found := c.items[k]; found && hard != ttl {
+		item.fresh = time.Now().Add(ttl).UnixNano()
+		c.items[k] = item
+	}
+	c.mu.Unlock()
+
+	c.evicted(evicted)
+
+	return v, nil
+} // }}}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"github.com/mlaoji/ygo/x/redis"
+	"time"
+)
+
+//基于 redis 的缓存, 值按 RedisClient 的 Codec 编码, defaultExpiration 为 ttl 传 0 时的过期时间(<= 0 为永不过期)
+func NewRedisStore(rc *redis.RedisClient, defaultExpiration time.Duration) *RedisStore { // {{{
+	return &RedisStore{rc: rc, defaultExpiration: defaultExpiration}
+} // }}}
+
+type RedisStore struct {
+	rc                *redis.RedisClient
+	defaultExpiration time.Duration
+	flight            Group
+}
+
+func (this *RedisStore) Get(k string, v interface{}) (bool, error) { // {{{
+	return this.rc.GetValue(k, v)
+} // }}}
+
+func (this *RedisStore) Set(k string, v interface{}, ttl time.Duration) error { // {{{
+	codec := this.rc.Codec
+	if nil == codec {
+		codec = redis.CodecJSON
+	}
+
+	b, err := codec.Marshal(v)
+	if nil != err {
+		return err
+	}
+
+	if 0 == ttl {
+		ttl = this.defaultExpiration
+	}
+
+	opt := redis.SetOption{}
+	if ttl > 0 {
+		opt.PX = int(ttl / time.Millisecond)
+		if opt.PX < 1 {
+			opt.PX = 1
+		}
+	}
+
+	_, err = this.rc.SetOpt(k, b, opt)
+
+	return err
+} // }}}
+
+func (this *RedisStore) Del(keys ...string) error { // {{{
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return this.rc.DelAll(keys)
+} // }}}
+
+func (this *RedisStore) GetOrLoad(k string, v interface{}, ttl time.Duration, loader func() (interface{}, error)) error { // {{{
+	found, err := this.Get(k, v)
+	if nil != err || found {
+		return err
+	}
+
+	val, err, _ := this.flight.Do(k, func() (interface{}, error) {
+		val, err := loader()
+		if nil != err {
+			return nil, err
+		}
+
+		return val, this.Set(k, val, ttl)
+	})
+
+	if nil != err {
+		return err
+	}
+
+	return assign(v, val)
+} // }}}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"sync"
+)
+
+//合并同一key的并发调用, 只执行一次fn, 其余调用等待并共享结果
+//fn 中的 panic 会传递给所有等待的调用方
+type Group struct {
+	mu sync.Mutex
+	m  map[string]*call
+}
+
+type call struct {
+	wg    sync.WaitGroup
+	val   interface{}
+	err   error
+	panic interface{}
+	dups  int
+}
+
+//执行并返回结果, shared 表示结果是否被多个调用方共享
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) { // {{{
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		g.mu.Unlock()
+		c.wg.Wait()
+
+		if c.panic != nil {
+			panic(c.panic)
+		}
+
+		return c.val, c.err, true
+	}
+
+	c := new(call)
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	g.doCall(c, key, fn)
+
+	if c.panic != nil {
+		panic(c.panic)
+	}
+
+	return c.val, c.err, c.dups > 0
+} // }}}
+
+//删除key, 之后的调用不再等待正在执行的fn
+func (g *Group) Forget(key string) { // {{{
+	g.mu.Lock()
+	delete(g.m, key)
+	g.mu.Unlock()
+} // }}}
+
+func (g *Group) doCall(c *call, key string, fn func() (interface{}, error)) { // {{{
+	defer func() {
+		if r := recover(); r != nil {
+			c.panic = r
+		}
+
+		g.mu.Lock()
+		c.wg.Done()
+		if g.m[key] == c {
+			delete(g.m, key)
+		}
+		g.mu.Unlock()
+	}()
+
+	c.val, c.err = fn()
+} // }}}
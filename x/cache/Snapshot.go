@@ -0,0 +1,365 @@
+package cache
+
+import (
+	"encoding/gob"
+	"errors"
+	"github.com/mlaoji/ygo/x/redis"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const snapshotVersion = 1
+
+func init() {
+	//快照默认使用 gob 编码, 自定义类型需调用 gob.Register 注册后才能保存
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+	gob.Register(map[string]string{})
+}
+
+type snapshotHeader struct {
+	Version int
+	Time    int64
+}
+
+//快照中的一条缓存, Namespace 为相对于保存快照的缓存的命名空间路径
+type snapshotEntry struct {
+	Namespace  string
+	Key        string
+	Expiration int64
+	Tags       []string
+	Data       []byte
+}
+
+//值保存为接口字段, 以便 gob 等编码方式记录具体类型
+type snapshotValue struct {
+	V interface{}
+}
+
+//加载快照时尚未创建的命名空间的缓存, 按命名空间路径(相对于根缓存)保存, 创建命名空间时加载
+type snapshotPending struct {
+	mu      sync.Mutex
+	entries map[string][]*pendingEntry
+}
+
+type pendingEntry struct {
+	key        string
+	value      interface{}
+	expiration int64
+	tags       []string
+}
+
+type snapshotOption struct {
+	codec redis.Codec
+}
+
+type FuncSnapshotOption func(o *snapshotOption)
+
+//SaveSnapshot/LoadSnapshot 设置参数 codec, 缓存值的编码方式, 默认 gob; 保存和加载需使用相同的编码方式
+func WithSnapshotCodec(codec redis.Codec) FuncSnapshotOption { // {{{
+	return func(o *snapshotOption) {
+		if nil != codec {
+			o.codec = codec
+		}
+	}
+} // }}}
+
+func newSnapshotOption(options []FuncSnapshotOption) *snapshotOption { // {{{
+	opt := &snapshotOption{codec: redis.CodecGob}
+	for _, o := range options {
+		o(opt)
+	}
+
+	return opt
+} // }}}
+
+//将未过期的缓存(包括命名空间的)及过期时间保存到文件, 无法编码的值(如 chan, func, 未注册的类型)跳过, 返回保存的数量
+//先写入临时文件再替换, 保存过程中进程退出不会破坏已有快照
+func (c *cache) SaveSnapshot(path string, options ...FuncSnapshotOption) (int, error) { // {{{
+	opt := newSnapshotOption(options)
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if nil != err {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	enc := gob.NewEncoder(tmp)
+	if err = enc.Encode(&snapshotHeader{Version: snapshotVersion, Time: time.Now().Unix()}); nil != err {
+		return 0, err
+	}
+
+	n, err := c.saveSnapshot(enc, opt.codec, "")
+	if nil != err {
+		return 0, err
+	}
+
+	//尚未创建的命名空间的缓存一并保存, 避免未使用该命名空间的进程保存时丢失
+	m, err := c.savePending(enc, opt.codec)
+	n += m
+	if nil != err {
+		return 0, err
+	}
+
+	if err = tmp.Sync(); nil != err {
+		return 0, err
+	}
+
+	if err = tmp.Close(); nil != err {
+		return 0, err
+	}
+
+	if err = os.Rename(tmp.Name(), path); nil != err {
+		return 0, err
+	}
+
+	return n, nil
+} // }}}
+
+func (c *cache) saveSnapshot(enc *gob.Encoder, codec redis.Codec, ns string) (int, error) { // {{{
+	items := c.Items()
+
+	c.mu.RLock()
+	namespaces := make(map[string]*Cache, len(c.namespaces))
+	for name, sub := range c.namespaces {
+		namespaces[name] = sub
+	}
+	c.mu.RUnlock()
+
+	n := 0
+	for k, item := range items {
+		data, err := codec.Marshal(&snapshotValue{item.Object})
+		if nil != err {
+			continue
+		}
+
+		entry := &snapshotEntry{Namespace: ns, Key: k, Expiration: item.Expiration, Tags: item.tags, Data: data}
+		if err = enc.Encode(entry); nil != err {
+			return n, err
+		}
+		n++
+	}
+
+	for name, sub := range namespaces {
+		if "" != ns {
+			name = ns + "/" + name
+		}
+
+		m, err := sub.saveSnapshot(enc, codec, name)
+		n += m
+		if nil != err {
+			return n, err
+		}
+	}
+
+	return n, nil
+} // }}}
+
+//从文件加载快照, 跳过已过期的, 已存在的key及无法解码的值, 返回加载的数量
+//不存在的命名空间的缓存暂存, 在创建该命名空间时加载, 也计入返回的数量
+func (c *cache) LoadSnapshot(path string, options ...FuncSnapshotOption) (int, error) { // {{{
+	opt := newSnapshotOption(options)
+
+	f, err := os.Open(path)
+	if nil != err {
+		return 0, err
+	}
+	defer f.Close()
+
+	dec := gob.NewDecoder(f)
+	header := &snapshotHeader{}
+	if err = dec.Decode(header); nil != err {
+		return 0, err
+	}
+
+	if snapshotVersion != header.Version {
+		return 0, errors.New("cache: unsupported snapshot version")
+	}
+
+	n := 0
+	for {
+		entry := &snapshotEntry{}
+		if err = dec.Decode(entry); nil != err {
+			if io.EOF == err {
+				return n, nil
+			}
+
+			return n, err
+		}
+
+		if c.loadEntry(entry, opt.codec) {
+			n++
+		}
+	}
+} // }}}
+
+func (c *cache) loadEntry(entry *snapshotEntry, codec redis.Codec) bool { // {{{
+	ttl := time.Duration(-1)
+	if entry.Expiration > 0 {
+		if ttl = time.Until(time.Unix(0, entry.Expiration)); ttl <= 0 {
+			return false
+		}
+	}
+
+	val := &snapshotValue{}
+	if err := codec.Unmarshal(entry.Data, val); nil != err {
+		return false
+	}
+
+	target := c.resolve(entry.Namespace)
+	if nil == target {
+		root := c.rootCache()
+		root.pending.mu.Lock()
+		if nil == root.pending.entries {
+			root.pending.entries = map[string][]*pendingEntry{}
+		}
+		path := c.subPath(entry.Namespace)
+		root.pending.entries[path] = append(root.pending.entries[path], &pendingEntry{entry.Key, val.V, entry.Expiration, entry.Tags})
+		root.pending.mu.Unlock()
+
+		return true
+	}
+
+	target.mu.Lock()
+	if _, _, found := target.get(entry.Key); found {
+		target.mu.Unlock()
+		return false
+	}
+
+	evicted := target.set(entry.Key, val.V, ttl)
+	target.tag(entry.Key, entry.Tags)
+	target.mu.Unlock()
+
+	target.evicted(evicted)
+
+	return true
+} // }}}
+
+//加载快照中暂存的当前命名空间的缓存
+func (c *cache) loadPending() { // {{{
+	root := c.rootCache()
+	if nil == root.pending {
+		return
+	}
+
+	root.pending.mu.Lock()
+	entries := root.pending.entries[c.name]
+	delete(root.pending.entries, c.name)
+	root.pending.mu.Unlock()
+
+	now := time.Now().UnixNano()
+	for _, e := range entries {
+		ttl := time.Duration(-1)
+		if e.expiration > 0 {
+			if e.expiration <= now {
+				continue
+			}
+			ttl = time.Duration(e.expiration - now)
+		}
+
+		c.mu.Lock()
+		if _, _, found := c.get(e.key); found {
+			c.mu.Unlock()
+			continue
+		}
+
+		evicted := c.set(e.key, e.value, ttl)
+		c.tag(e.key, e.tags)
+		c.mu.Unlock()
+
+		c.evicted(evicted)
+	}
+} // }}}
+
+//保存暂存的、属于当前缓存下的命名空间的缓存
+func (c *cache) savePending(enc *gob.Encoder, codec redis.Codec) (int, error) { // {{{
+	root := c.rootCache()
+	if nil == root.pending {
+		return 0, nil
+	}
+
+	root.pending.mu.Lock()
+	all := make(map[string][]*pendingEntry, len(root.pending.entries))
+	for path, entries := range root.pending.entries {
+		all[path] = entries
+	}
+	root.pending.mu.Unlock()
+
+	n := 0
+	now := time.Now().UnixNano()
+	for path, entries := range all {
+		ns := path
+		if "" != c.name {
+			if !strings.HasPrefix(path, c.name+"/") {
+				continue
+			}
+			ns = path[len(c.name)+1:]
+		}
+
+		for _, e := range entries {
+			if e.expiration > 0 && e.expiration <= now {
+				continue
+			}
+
+			data, err := codec.Marshal(&snapshotValue{e.value})
+			if nil != err {
+				continue
+			}
+
+			if err = enc.Encode(&snapshotEntry{Namespace: ns, Key: e.key, Expiration: e.expiration, Tags: e.tags, Data: data}); nil != err {
+				return n, err
+			}
+			n++
+		}
+	}
+
+	return n, nil
+} // }}}
+
+//命名空间所属的根缓存
+func (c *cache) rootCache() *cache { // {{{
+	if nil != c.root {
+		return c.root
+	}
+
+	return c
+} // }}}
+
+//相对于当前缓存的命名空间路径转为相对于根缓存的路径
+func (c *cache) subPath(path string) string { // {{{
+	if "" == c.name {
+		return path
+	}
+
+	return c.name + "/" + path
+} // }}}
+
+//每隔 interval 保存一次快照, 直到缓存被回收
+func (c *cache) AutoSnapshot(path string, interval time.Duration, options ...FuncSnapshotOption) { // {{{
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := c.SaveSnapshot(path, options...); nil != err {
+					log.Printf("cache snapshot err: %v\n", err)
+				}
+			case <-c.ctx.Done():
+				return
+			}
+		}
+	}()
+} // }}}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+)
+
+//统一的缓存接口, 由 LocalStore(进程内), RedisStore 及 TieredStore(进程内+redis 两级) 实现
+//ttl > 0 为过期时间, 0 使用默认过期时间, -1 永不过期; v 为接收结果的指针
+type Store interface {
+	//读取缓存到 v, 返回是否存在
+	Get(k string, v interface{}) (bool, error)
+	Set(k string, v interface{}, ttl time.Duration) error
+	Del(keys ...string) error
+	//读取缓存到 v, 不存在时调用 loader 加载并缓存, 同一进程中同一key的并发加载只调用一次 loader
+	GetOrLoad(k string, v interface{}, ttl time.Duration, loader func() (interface{}, error)) error
+}
+
+var ErrInvalidDest = errors.New("cache: dest must be a non-nil pointer")
+
+//进程内缓存, 保存的是值本身, 修改取出的 map, 切片等会影响缓存中的值
+func NewLocalStore(c *Cache) *LocalStore { // {{{
+	return &LocalStore{c}
+} // }}}
+
+type LocalStore struct {
+	c *Cache
+}
+
+func (this *LocalStore) Get(k string, v interface{}) (bool, error) { // {{{
+	val, found := this.c.Get(k)
+	if !found {
+		return false, nil
+	}
+
+	return true, assign(v, val)
+} // }}}
+
+func (this *LocalStore) Set(k string, v interface{}, ttl time.Duration) error { // {{{
+	if 0 == ttl {
+		this.c.Set(k, v)
+	} else {
+		this.c.Set(k, v, ttl)
+	}
+
+	return nil
+} // }}}
+
+func (this *LocalStore) Del(keys ...string) error { // {{{
+	for _, k := range keys {
+		this.c.Del(k)
+	}
+
+	return nil
+} // }}}
+
+func (this *LocalStore) GetOrLoad(k string, v interface{}, ttl time.Duration, loader func() (interface{}, error)) error { // {{{
+	val, err := this.c.GetOrLoad(k, ttl, loader)
+	if nil != err {
+		return err
+	}
+
+	return assign(v, val)
+} // }}}
+
+//将 src 赋值给指针 dst 指向的变量, 类型不一致时(如广播收到的 json 解码后的值)通过 json 转换
+func assign(dst, src interface{}) error { // {{{
+	dv := reflect.ValueOf(dst)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return ErrInvalidDest
+	}
+
+	elem := dv.Elem()
+	if nil == src {
+		elem.Set(reflect.Zero(elem.Type()))
+		return nil
+	}
+
+	sv := reflect.ValueOf(src)
+	if sv.Type().AssignableTo(elem.Type()) {
+		elem.Set(sv)
+		return nil
+	}
+
+	b, err := json.Marshal(src)
+	if nil != err {
+		return err
+	}
+
+	return json.Unmarshal(b, dst)
+} // }}}
+
+//新建 v 指向类型的零值, 返回其指针
+func newDest(v interface{}) (reflect.Value, error) { // {{{
+	dv := reflect.ValueOf(v)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return reflect.Value{}, ErrInvalidDest
+	}
+
+	return reflect.New(dv.Elem().Type()), nil
+} // }}}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"strings"
+	"time"
+)
+
+//设置缓存并打上标签, 之后可通过 DelTag/InvalidateTag 按标签批量删除; 再次 Set 同一key时原标签失效
+func (c *cache) SetTags(k string, v interface{}, tags []string, td ...time.Duration) { // {{{
+	c.mu.Lock()
+	evicted := c.set(k, v, td...)
+	c.tag(k, tags)
+	c.mu.Unlock()
+
+	c.evicted(evicted)
+} // }}}
+
+//删除带有任一标签的缓存, 返回删除的数量
+func (c *cache) DelTag(tags ...string) int { // {{{
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for _, tag := range tags {
+		for k := range c.tags[tag] {
+			if item, found := c.items[k]; found {
+				c.remove(k, item)
+				n++
+			}
+		}
+		delete(c.tags, tag)
+	}
+
+	return n
+} // }}}
+
+//删除以任一前缀开头的缓存, 返回删除的数量
+func (c *cache) DelPrefix(prefixes ...string) int { // {{{
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for k, item := range c.items {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(k, prefix) {
+				c.remove(k, item)
+				n++
+				break
+			}
+		}
+	}
+
+	for k := range c.loads {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(k, prefix) {
+				c.abortLoad(k)
+				break
+			}
+		}
+	}
+
+	return n
+} // }}}
+
+//记录标签, 需持有写锁
+func (c *cache) tag(k string, tags []string) { // {{{
+	item, found := c.items[k]
+	if !found || len(tags) == 0 {
+		return
+	}
+
+	item.tags = tags
+	c.items[k] = item
+
+	if nil == c.tags {
+		c.tags = map[string]map[string]struct{}{}
+	}
+
+	for _, tag := range tags {
+		if nil == c.tags[tag] {
+			c.tags[tag] = map[string]struct{}{}
+		}
+		c.tags[tag][k] = struct{}{}
+	}
+} // }}}
+
+//删除标签记录, 需持有写锁
+func (c *cache) untag(k string, tags []string) { // {{{
+	for _, tag := range tags {
+		if keys, ok := c.tags[tag]; ok {
+			delete(keys, k)
+			if len(keys) == 0 {
+				delete(c.tags, tag)
+			}
+		}
+	}
+} // }}}
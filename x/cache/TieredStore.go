@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"github.com/mlaoji/ygo/x/redis"
+	"log"
+	"reflect"
+	"time"
+)
+
+//两级缓存, L1 为进程内缓存, L2 为 redis; 读取时依次查找并回填 L1, 写入和删除时同时更新两级, 并通过 L2 的 redis 广播让其他进程删除 L1
+//用法:
+//  store := cache.NewTieredStore(x.LocalCache.Namespace("user"), cache.NewRedisStore(rc, time.Hour), cache.WithL1TTL(time.Minute))
+//  defer store.Close()
+//  var u User
+//  err := store.GetOrLoad("user:1", &u, 0, func() (interface{}, error) { return loadUser(1) })
+func NewTieredStore(l1 *Cache, l2 *RedisStore, options ...FuncTieredOption) *TieredStore { // {{{
+	s := &TieredStore{
+		Channel: PubSubChannel,
+		l1:      l1,
+		l2:      l2,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	//广播消息按命名空间路径从根缓存查找
+	root := l1.cache
+	if nil != root.root {
+		root = root.root
+	}
+
+	s.sub = l2.rc.NewSubscriber(redis.WithSubErrorHandler(func(err error) {
+		log.Printf("tiered cache subscribe err: %v\n", err)
+	}))
+	s.sub.Subscribe(func(msg *redis.PubSubMessage) {
+		root.receive(msg.Message)
+	}, s.Channel)
+	s.sub.Start()
+
+	return s
+} // }}}
+
+type FuncTieredOption func(s *TieredStore)
+
+//NewTieredStore 设置参数 L1TTL, L1 的最长缓存时间, 用于限制广播丢失时旧值的存活时间, 0 为不限制
+func WithL1TTL(ttl time.Duration) FuncTieredOption { // {{{
+	return func(s *TieredStore) {
+		if ttl >= 0 {
+			s.L1TTL = ttl
+		}
+	}
+} // }}}
+
+//NewTieredStore 设置参数 Channel, 广播 L1 失效的频道, 默认为 PubSubChannel
+func WithTieredChannel(channel string) FuncTieredOption { // {{{
+	return func(s *TieredStore) {
+		if "" != channel {
+			s.Channel = channel
+		}
+	}
+} // }}}
+
+type TieredStore struct {
+	L1TTL   time.Duration
+	Channel string
+
+	l1  *Cache
+	l2  *RedisStore
+	sub *redis.Subscriber
+}
+
+func (this *TieredStore) Get(k string, v interface{}) (bool, error) { // {{{
+	if val, found := this.l1.Get(k); found {
+		return true, assign(v, val)
+	}
+
+	found, err := this.l2.Get(k, v)
+	if nil != err || !found {
+		return found, err
+	}
+
+	this.setL1(k, reflect.ValueOf(v).Elem().Interface(), 0)
+
+	return true, nil
+} // }}}
+
+func (this *TieredStore) Set(k string, v interface{}, ttl time.Duration) error { // {{{
+	if err := this.l2.Set(k, v, ttl); nil != err {
+		return err
+	}
+
+	this.setL1(k, v, ttl)
+
+	return this.publish(k)
+} // }}}
+
+func (this *TieredStore) Del(keys ...string) error { // {{{
+	if err := this.l2.Del(keys...); nil != err {
+		return err
+	}
+
+	for _, k := range keys {
+		this.l1.Del(k)
+	}
+
+	return this.publish(keys...)
+} // }}}
+
+//L1 未命中时从 L2 读取, L2 也未命中时调用 loader 并写入两级缓存
+func (this *TieredStore) GetOrLoad(k string, v interface{}, ttl time.Duration, loader func() (interface{}, error)) error { // {{{
+	val, err := this.l1.GetOrLoad(k, this.l1TTL(ttl), func() (interface{}, error) {
+		dest, err := newDest(v)
+		if nil != err {
+			return nil, err
+		}
+
+		if err = this.l2.GetOrLoad(k, dest.Interface(), ttl, loader); nil != err {
+			return nil, err
+		}
+
+		return dest.Elem().Interface(), nil
+	})
+
+	if nil != err {
+		return err
+	}
+
+	return assign(v, val)
+} // }}}
+
+//停止接收广播
+func (this *TieredStore) Close() { // {{{
+	this.sub.Stop()
+} // }}}
+
+func (this *TieredStore) setL1(k string, v interface{}, ttl time.Duration) { // {{{
+	if ttl = this.l1TTL(ttl); 0 == ttl {
+		this.l1.Set(k, v)
+	} else {
+		this.l1.Set(k, v, ttl)
+	}
+} // }}}
+
+//L1 的过期时间不超过 L1TTL
+func (this *TieredStore) l1TTL(ttl time.Duration) time.Duration { // {{{
+	if this.L1TTL > 0 && (ttl <= 0 || ttl > this.L1TTL) {
+		return this.L1TTL
+	}
+
+	return ttl
+} // }}}
+
+//通知其他进程删除 L1
+func (this *TieredStore) publish(keys ...string) error { // {{{
+	return publish(this.l2.rc, this.Channel, &Message{Op: BROADCAST_DEL, Keys: keys, Namespace: this.l1.name, Sender: SenderId})
+} // }}}
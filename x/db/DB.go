@@ -1,13 +1,18 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"time"
 )
 
 type Executor interface {
 	QueryRow(query string, args ...interface{}) *sql.Row
 	Exec(query string, args ...interface{}) (sql.Result, error)
 	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
 }
 
 type DbExecutor struct {
@@ -21,10 +26,15 @@ type TxExecutor struct {
 type DBClient interface {
 	Init() error
 	ID() string
+	WithRequestId(request_id string) DBClient
+	WithContext(ctx context.Context) DBClient
+	WithTimeout(timeout time.Duration) DBClient
+	WithNull() DBClient
 	SetDebug(open bool)
 	Begin(is_readonly bool) DBClient
 	Rollback()
 	Commit()
+	AfterCommit(fn func())
 	GetOne(_sql string, val ...interface{}) interface{}
 	Insert(table string, vals map[string]interface{}) int
 	Replace(table string, vals map[string]interface{}) int
@@ -32,4 +42,6 @@ type DBClient interface {
 	Execute(_sql string, val ...interface{}) int
 	GetRow(_sql string, val ...interface{}) map[string]interface{}
 	GetAll(_sql string, val ...interface{}) []map[string]interface{}
+	Rows(_sql string, val ...interface{}) RowIterator
+	Each(_sql string, fn func(row map[string]interface{}) bool, val ...interface{}) int
 }
@@ -0,0 +1,534 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//用于单元测试的 DBClient, 不连接数据库:
+//记录执行的sql及参数, 按sql匹配返回预设的结果或错误, 模拟事务的开启、提交及回滚
+//可通过 x.DB.Set(conf_name, fake) 替换指定配置的db, 如:
+//	fake := db.NewFakeClient()
+//	fake.On("select .* from user where uid=\\?").Return(map[string]interface{}{"uid": 1, "name": "x"})
+//	restore := x.DB.Set("db_master", fake)
+//	defer x.DB.Set("db_master", restore)
+//	...
+//	fake.ExpectQuery(t, "update user set")
+func NewFakeClient(id ...string) *FakeClient { // {{{
+	c := &FakeClient{state: &fakeState{}}
+	c.id = "fake"
+	if len(id) > 0 {
+		c.id = id[0]
+	}
+
+	return c
+} // }}}
+
+//执行过的一条sql
+type FakeQuery struct {
+	Method string //GetOne/GetRow/GetAll/Rows/Insert/Replace/Update/Execute
+	Sql    string
+	Params []interface{}
+	Tx     bool //是否在事务中执行
+}
+
+func (this *FakeQuery) String() string { // {{{
+	return fmt.Sprintf("%s %s %v", this.Method, this.Sql, this.Params)
+} // }}}
+
+//按sql匹配的预设结果
+type FakeRule struct {
+	reg      *regexp.Regexp
+	rows     []map[string]interface{}
+	value    interface{}
+	affected int
+	setAff   bool
+	err      interface{}
+	times    int //剩余可匹配次数, 0 表示不限
+}
+
+//查询返回的记录, GetRow 返回第一条, GetOne 返回第一条记录中的第一个字段(或 ReturnOne 设置的值)
+//记录中的值会转为字符串(nil 转为"", WithNull 时保留 nil), 与 MysqlClient 一致
+func (this *FakeRule) Return(rows ...map[string]interface{}) *FakeRule { // {{{
+	this.rows = rows
+	return this
+} // }}}
+
+//GetOne 返回的值
+func (this *FakeRule) ReturnOne(val interface{}) *FakeRule { // {{{
+	this.value = val
+	return this
+} // }}}
+
+//Insert/Replace 返回的id, Update/Execute 返回的影响行数
+func (this *FakeRule) ReturnAffected(n int) *FakeRule { // {{{
+	this.affected = n
+	this.setAff = true
+	return this
+} // }}}
+
+//模拟db错误, 与 MysqlClient 一致以 panic 形式抛出
+func (this *FakeRule) Error(err interface{}) *FakeRule { // {{{
+	this.err = err
+	return this
+} // }}}
+
+//只匹配n次
+func (this *FakeRule) Times(n int) *FakeRule { // {{{
+	this.times = n
+	return this
+} // }}}
+
+//事务中与开启事务的 FakeClient 共享的状态
+type fakeState struct {
+	mutex     sync.Mutex
+	rules     []*FakeRule
+	queries   []*FakeQuery
+	lastId    int
+	begins    int
+	commits   int
+	rollbacks int
+}
+
+type FakeClient struct {
+	id          string
+	debug       bool
+	intx        bool
+	readonly    bool
+	keepNull    bool
+	state       *fakeState
+	afterCommit *[]func()
+}
+
+func (this *FakeClient) Init() error { // {{{
+	return nil
+} // }}}
+
+func (this *FakeClient) ID() string { // {{{
+	return this.id
+} // }}}
+
+func (this *FakeClient) WithRequestId(request_id string) DBClient { // {{{
+	return this
+} // }}}
+
+func (this *FakeClient) WithContext(ctx context.Context) DBClient { // {{{
+	return this
+} // }}}
+
+func (this *FakeClient) WithTimeout(timeout time.Duration) DBClient { // {{{
+	return this
+} // }}}
+
+func (this *FakeClient) WithNull() DBClient { // {{{
+	c := *this
+	c.keepNull = true
+
+	return &c
+} // }}}
+
+func (this *FakeClient) SetDebug(open bool) { // {{{
+	this.debug = open
+} // }}}
+
+//设置sql匹配规则(正则, 不区分大小写), 按设置顺序匹配, 如: fake.On("^select .* from user").Return(row)
+func (this *FakeClient) On(pattern string) *FakeRule { // {{{
+	rule := &FakeRule{reg: regexp.MustCompile("(?i)" + pattern)}
+
+	this.state.mutex.Lock()
+	this.state.rules = append(this.state.rules, rule)
+	this.state.mutex.Unlock()
+
+	return rule
+} // }}}
+
+//清空匹配规则及执行记录, Insert 返回的自增id重新从1开始
+func (this *FakeClient) Reset() { // {{{
+	this.state.mutex.Lock()
+	defer this.state.mutex.Unlock()
+
+	this.state.rules = nil
+	this.state.queries = nil
+	this.state.lastId = 0
+	this.state.begins, this.state.commits, this.state.rollbacks = 0, 0, 0
+} // }}}
+
+//已执行的sql
+func (this *FakeClient) Queries() []*FakeQuery { // {{{
+	this.state.mutex.Lock()
+	defer this.state.mutex.Unlock()
+
+	return append([]*FakeQuery{}, this.state.queries...)
+} // }}}
+
+//开启、提交及回滚事务的次数
+func (this *FakeClient) TxCount() (begins, commits, rollbacks int) { // {{{
+	this.state.mutex.Lock()
+	defer this.state.mutex.Unlock()
+
+	return this.state.begins, this.state.commits, this.state.rollbacks
+} // }}}
+
+func (this *FakeClient) Begin(is_readonly bool) DBClient { // {{{
+	this.state.mutex.Lock()
+	this.state.begins++
+	this.state.mutex.Unlock()
+
+	if this.debug {
+		fmt.Println("Begin transaction on #ID:", this.id)
+	}
+
+	return &FakeClient{id: this.id, debug: this.debug, intx: true, readonly: is_readonly, keepNull: this.keepNull, state: this.state, afterCommit: &[]func(){}}
+} // }}}
+
+func (this *FakeClient) Rollback() { // {{{
+	if !this.intx {
+		return
+	}
+
+	this.intx = false
+	*this.afterCommit = nil
+
+	this.state.mutex.Lock()
+	this.state.rollbacks++
+	this.state.mutex.Unlock()
+} // }}}
+
+func (this *FakeClient) Commit() { // {{{
+	if !this.intx {
+		return
+	}
+
+	this.intx = false
+
+	this.state.mutex.Lock()
+	this.state.commits++
+	this.state.mutex.Unlock()
+
+	fns := *this.afterCommit
+	*this.afterCommit = nil
+	for _, fn := range fns {
+		fn()
+	}
+} // }}}
+
+func (this *FakeClient) AfterCommit(fn func()) { // {{{
+	if this.intx {
+		*this.afterCommit = append(*this.afterCommit, fn)
+		return
+	}
+
+	fn()
+} // }}}
+
+func (this *FakeClient) GetOne(_sql string, val ...interface{}) interface{} { // {{{
+	rule := this.exec("GetOne", _sql, val)
+	if nil == rule {
+		return ""
+	}
+
+	if nil != rule.value {
+		return fmt.Sprint(rule.value)
+	}
+
+	if len(rule.rows) > 0 {
+		row := fakeRow(rule.rows[0], false)
+		keys := make([]string, 0, len(row))
+		for k := range row {
+			keys = append(keys, k)
+		}
+
+		if len(keys) > 0 {
+			sort.Strings(keys)
+			return row[keys[0]]
+		}
+	}
+
+	return ""
+} // }}}
+
+func (this *FakeClient) Insert(table string, vals map[string]interface{}) int { // {{{
+	return this.insert("Insert", table, vals)
+} // }}}
+
+func (this *FakeClient) Replace(table string, vals map[string]interface{}) int { // {{{
+	return this.insert("Replace", table, vals)
+} // }}}
+
+func (this *FakeClient) insert(method, table string, vals map[string]interface{}) int { // {{{
+	set, value := fakeSet(vals)
+	rule := this.exec(method, strings.ToLower(method)+" into "+table+" set "+set, value)
+	if nil != rule && rule.setAff {
+		return rule.affected
+	}
+
+	this.state.mutex.Lock()
+	defer this.state.mutex.Unlock()
+
+	this.state.lastId++
+	return this.state.lastId
+} // }}}
+
+//未设置 ReturnAffected 时返回1
+func (this *FakeClient) Update(table string, vals map[string]interface{}, where string, val ...interface{}) int { // {{{
+	set, value := fakeSet(vals)
+	rule := this.exec("Update", "update "+table+" set "+set+" where "+where, append(value, val...))
+	if nil != rule && rule.setAff {
+		return rule.affected
+	}
+
+	return 1
+} // }}}
+
+//未设置 ReturnAffected 时返回1
+func (this *FakeClient) Execute(_sql string, val ...interface{}) int { // {{{
+	rule := this.exec("Execute", _sql, val)
+	if nil != rule && rule.setAff {
+		return rule.affected
+	}
+
+	return 1
+} // }}}
+
+func (this *FakeClient) GetRow(_sql string, val ...interface{}) map[string]interface{} { // {{{
+	list := this.getAll("GetRow", _sql, val)
+	if len(list) > 0 {
+		return list[0]
+	}
+
+	return make(map[string]interface{}, 0)
+} // }}}
+
+func (this *FakeClient) GetAll(_sql string, val ...interface{}) []map[string]interface{} { // {{{
+	return this.getAll("GetAll", _sql, val)
+} // }}}
+
+func (this *FakeClient) getAll(method, _sql string, val []interface{}) []map[string]interface{} { // {{{
+	rule := this.exec(method, _sql, val)
+	if nil == rule {
+		return nil
+	}
+
+	var data []map[string]interface{}
+	for _, row := range rule.rows {
+		data = append(data, fakeRow(row, this.keepNull))
+	}
+
+	return data
+} // }}}
+
+func (this *FakeClient) Rows(_sql string, val ...interface{}) RowIterator { // {{{
+	return &fakeRows{list: this.getAll("Rows", _sql, val), idx: -1}
+} // }}}
+
+func (this *FakeClient) Each(_sql string, fn func(row map[string]interface{}) bool, val ...interface{}) int { // {{{
+	rows := this.Rows(_sql, val...)
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		n++
+		if !fn(rows.Row()) {
+			break
+		}
+	}
+
+	return n
+} // }}}
+
+//记录sql并查找匹配的规则, 规则设置了错误时 panic
+func (this *FakeClient) exec(method, _sql string, val []interface{}) *FakeRule { // {{{
+	if this.debug {
+		fmt.Println(map[string]interface{}{"tx": this.intx, "sql": _sql, "val": val, "#ID": this.id})
+	}
+
+	if this.readonly && ("Insert" == method || "Replace" == method || "Update" == method || "Execute" == method) {
+		errorHandle("fake: cannot execute " + method + " in a read-only transaction")
+	}
+
+	this.state.mutex.Lock()
+	this.state.queries = append(this.state.queries, &FakeQuery{Method: method, Sql: _sql, Params: val, Tx: this.intx})
+
+	var rule *FakeRule
+	for _, r := range this.state.rules {
+		if r.times < 0 || !r.reg.MatchString(_sql) {
+			continue
+		}
+
+		if r.times > 0 {
+			r.times--
+			if 0 == r.times {
+				r.times = -1
+			}
+		}
+
+		rule = r
+		break
+	}
+	this.state.mutex.Unlock()
+
+	if nil != rule && nil != rule.err {
+		errorHandle(rule.err)
+	}
+
+	return rule
+} // }}}
+
+//用于断言的测试对象, 即 *testing.T
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+//断言执行过匹配 pattern 的sql, params 不为空时同时比较参数, 返回匹配的sql
+func (this *FakeClient) ExpectQuery(t TestingT, pattern string, params ...interface{}) *FakeQuery { // {{{
+	t.Helper()
+
+	reg := regexp.MustCompile("(?i)" + pattern)
+	for _, q := range this.Queries() {
+		if reg.MatchString(q.Sql) && (0 == len(params) || fmt.Sprintf("%v", params) == fmt.Sprintf("%v", q.Params)) {
+			return q
+		}
+	}
+
+	t.Errorf("expected query %q %v was not executed, executed:\n%s", pattern, params, this.dump())
+	return nil
+} // }}}
+
+//断言没有执行过匹配 pattern 的sql
+func (this *FakeClient) ExpectNoQuery(t TestingT, pattern string) { // {{{
+	t.Helper()
+
+	reg := regexp.MustCompile("(?i)" + pattern)
+	for _, q := range this.Queries() {
+		if reg.MatchString(q.Sql) {
+			t.Errorf("unexpected query: %s", q)
+		}
+	}
+} // }}}
+
+//断言执行的sql数量
+func (this *FakeClient) ExpectQueryCount(t TestingT, n int) { // {{{
+	t.Helper()
+
+	if l := len(this.Queries()); l != n {
+		t.Errorf("expected %d queries, got %d:\n%s", n, l, this.dump())
+	}
+} // }}}
+
+//断言事务已提交(提交次数大于0且每个事务都已结束)
+func (this *FakeClient) ExpectCommitted(t TestingT) { // {{{
+	t.Helper()
+
+	begins, commits, rollbacks := this.TxCount()
+	if 0 == commits || begins != commits+rollbacks {
+		t.Errorf("expected transaction committed, begins: %d, commits: %d, rollbacks: %d", begins, commits, rollbacks)
+	}
+} // }}}
+
+//断言事务已回滚(没有提交)
+func (this *FakeClient) ExpectRolledBack(t TestingT) { // {{{
+	t.Helper()
+
+	begins, commits, rollbacks := this.TxCount()
+	if 0 == rollbacks || 0 != commits {
+		t.Errorf("expected transaction rolled back, begins: %d, commits: %d, rollbacks: %d", begins, commits, rollbacks)
+	}
+} // }}}
+
+func (this *FakeClient) dump() string { // {{{
+	buf := bytes.NewBufferString("")
+	for _, q := range this.Queries() {
+		buf.WriteString("\t" + q.String() + "\n")
+	}
+
+	return buf.String()
+} // }}}
+
+//按字段名排序生成 "a=?,b=?", 以便匹配
+func fakeSet(vals map[string]interface{}) (string, []interface{}) { // {{{
+	cols := make([]string, 0, len(vals))
+	for col := range vals {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+
+	var value []interface{}
+	buf := bytes.NewBufferString("")
+	for i, col := range cols {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+
+		buf.WriteString(col)
+		buf.WriteString("=")
+
+		if fval := fmt.Sprint(vals[col]); strings.HasPrefix(fval, "#:F:#") {
+			buf.WriteString(fval[5:])
+		} else {
+			buf.WriteString("?")
+			value = append(value, vals[col])
+		}
+	}
+
+	return buf.String(), value
+} // }}}
+
+func fakeRow(row map[string]interface{}, keep_null bool) map[string]interface{} { // {{{
+	ret := make(map[string]interface{}, len(row))
+	for k, v := range row {
+		if nil == v && keep_null {
+			ret[k] = nil
+		} else if nil == v {
+			ret[k] = ""
+		} else if b, ok := v.([]byte); ok {
+			ret[k] = string(b)
+		} else {
+			ret[k] = fmt.Sprint(v)
+		}
+	}
+
+	return ret
+} // }}}
+
+type fakeRows struct {
+	list []map[string]interface{}
+	idx  int
+}
+
+func (this *fakeRows) Next() bool { // {{{
+	this.idx++
+	return this.idx < len(this.list)
+} // }}}
+
+func (this *fakeRows) Row() map[string]interface{} { // {{{
+	if this.idx < 0 || this.idx >= len(this.list) {
+		return nil
+	}
+
+	return this.list[this.idx]
+} // }}}
+
+func (this *fakeRows) Columns() []string { // {{{
+	if 0 == len(this.list) {
+		return nil
+	}
+
+	cols := []string{}
+	for k := range this.list[0] {
+		cols = append(cols, k)
+	}
+	sort.Strings(cols)
+
+	return cols
+} // }}}
+
+func (this *fakeRows) Close() { // {{{
+	this.idx = len(this.list)
+} // }}}
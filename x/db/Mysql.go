@@ -12,7 +12,7 @@ import (
 	"time"
 )
 
-func NewMysqlClient(host, user, password, database, charset string, max_open_conns, max_idle_conns int) (*MysqlClient, error) { // {{{
+func NewMysqlClient(host, user, password, database, charset string, max_open_conns, max_idle_conns int, options ...FuncMcOption) (*MysqlClient, error) { // {{{
 	c := &MysqlClient{
 		Host:         host,
 		User:         user,
@@ -23,26 +23,112 @@ func NewMysqlClient(host, user, password, database, charset string, max_open_con
 		MaxIdleConns: max_idle_conns,
 	}
 
+	for _, opt := range options {
+		opt(c)
+	}
+
 	err := c.Init()
 
 	return c, err
 } // }}}
 
+type FuncMcOption func(c *MysqlClient)
+
+//NewMysqlClient 设置参数 ConfName, 用于慢查询日志及统计
+func WithConfName(name string) FuncMcOption { // {{{
+	return func(c *MysqlClient) {
+		c.ConfName = name
+	}
+} // }}}
+
+//NewMysqlClient 设置参数 SlowThreshold, 单位:毫秒, 0 则不记录慢查询
+func WithSlowThreshold(ms int) FuncMcOption { // {{{
+	return func(c *MysqlClient) {
+		if ms > 0 {
+			c.SlowThreshold = ms
+		}
+	}
+} // }}}
+
+//NewMysqlClient 设置参数 SlowExplain, 慢查询为select时, 是否记录explain结果
+func WithSlowExplain(open bool) FuncMcOption { // {{{
+	return func(c *MysqlClient) {
+		c.SlowExplain = open
+	}
+} // }}}
+
+//NewMysqlClient 设置参数 QueryTimeout, 单位:毫秒, 默认查询超时时间, 0 则不限制, 可通过 WithTimeout 对单次调用设置
+func WithQueryTimeout(ms int) FuncMcOption { // {{{
+	return func(c *MysqlClient) {
+		if ms > 0 {
+			c.QueryTimeout = time.Duration(ms) * time.Millisecond
+		}
+	}
+} // }}}
+
+//NewMysqlClient 设置参数 StmtCacheSize, 缓存的预处理语句数, 0 则不缓存; 事务中的查询不使用缓存
+func WithStmtCache(size int) FuncMcOption { // {{{
+	return func(c *MysqlClient) {
+		if size > 0 {
+			c.StmtCacheSize = size
+		}
+	}
+} // }}}
+
+//NewMysqlClient 设置参数 ConnMaxLifetime, 单位:秒, 连接最长使用时间
+func WithConnMaxLifetime(secs int) FuncMcOption { // {{{
+	return func(c *MysqlClient) {
+		if secs > 0 {
+			c.ConnMaxLifetime = time.Duration(secs) * time.Second
+		}
+	}
+} // }}}
+
+//NewMysqlClient 设置参数 ConnMaxIdleTime, 单位:秒, 连接最长空闲时间
+func WithConnMaxIdleTime(secs int) FuncMcOption { // {{{
+	return func(c *MysqlClient) {
+		if secs > 0 {
+			c.ConnMaxIdleTime = time.Duration(secs) * time.Second
+		}
+	}
+} // }}}
+
+//NewMysqlClient 设置参数 QueryStats, 是否按sql指纹汇总统计
+func WithQueryStats(open bool) FuncMcOption { // {{{
+	return func(c *MysqlClient) {
+		c.QueryStats = open
+	}
+} // }}}
+
 type MysqlClient struct {
-	Host         string
-	User         string
-	Password     string
-	Database     string
-	Charset      string
-	MaxOpenConns int
-	MaxIdleConns int
-	Debug        bool
-	id           string
-	db           *sql.DB
-	intx         bool
-	tx           *sql.Tx
-	executor     Executor
-	p            *MysqlClient //实际上没什么用，只在事务中打印调式信息时使用(因为在事务中执行explain语句会出现'busy buffer'的错误)
+	Host            string
+	User            string
+	Password        string
+	Database        string
+	Charset         string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	Debug           bool
+	ConfName        string        //配置名
+	SlowThreshold   int           //慢查询阈值, 单位:毫秒
+	SlowExplain     bool          //慢查询记录explain
+	QueryStats      bool          //按sql指纹统计
+	QueryTimeout    time.Duration //默认查询超时时间
+	StmtCacheSize   int           //缓存的预处理语句数
+	ConnMaxLifetime time.Duration //连接最长使用时间
+	ConnMaxIdleTime time.Duration //连接最长空闲时间
+	requestId       string
+	id              string
+	db              *sql.DB
+	intx            bool
+	tx              *sql.Tx
+	afterCommit     *[]func() //事务提交后执行的回调
+	executor        Executor
+	stmts           *stmtCache
+	ctx             context.Context //通过 WithContext 设置
+	timeout         time.Duration   //通过 WithTimeout 设置, 优先于 QueryTimeout
+	keepNull        bool            //通过 WithNull 设置, 查询结果中的 NULL 保留为 nil
+	p               *MysqlClient    //实际上没什么用，只在事务中打印调式信息时使用(因为在事务中执行explain语句会出现'busy buffer'的错误)
 }
 
 //Init {{{
@@ -66,6 +152,18 @@ func (this *MysqlClient) Init() error {
 		this.db.SetMaxIdleConns(this.MaxIdleConns)
 	}
 
+	if this.ConnMaxLifetime > 0 {
+		this.db.SetConnMaxLifetime(this.ConnMaxLifetime)
+	}
+
+	if this.ConnMaxIdleTime > 0 {
+		this.db.SetConnMaxIdleTime(this.ConnMaxIdleTime)
+	}
+
+	if this.StmtCacheSize > 0 {
+		this.stmts = newStmtCache(this.StmtCacheSize)
+	}
+
 	this.executor = &DbExecutor{this.db}
 	//defer this.db.Close()
 
@@ -86,9 +184,46 @@ func (this *MysqlClient) ID() string { //{{{
 	return this.id
 } //}}}
 
+//返回一个带请求id的副本(共用连接池及事务), 请求id会记录在慢查询日志中
+func (this *MysqlClient) WithRequestId(request_id string) DBClient { //{{{
+	c := *this
+	c.requestId = request_id
+
+	return &c
+} //}}}
+
+//返回一个使用指定context的副本(共用连接池及事务), context 取消或超时时中止查询
+func (this *MysqlClient) WithContext(ctx context.Context) DBClient { //{{{
+	c := *this
+	c.ctx = ctx
+
+	return &c
+} //}}}
+
+//返回一个使用指定查询超时时间的副本(共用连接池及事务), 如: client.WithTimeout(time.Second).GetAll(...)
+func (this *MysqlClient) WithTimeout(timeout time.Duration) DBClient { //{{{
+	c := *this
+	c.timeout = timeout
+
+	return &c
+} //}}}
+
+//返回一个将查询结果(GetRow/GetAll/Rows/Each)中的 NULL 读取为 nil 的副本(共用连接池及事务), 默认读取为空字符串
+func (this *MysqlClient) WithNull() DBClient { //{{{
+	c := *this
+	c.keepNull = true
+
+	return &c
+} //}}}
+
 func (this *MysqlClient) Begin(is_readonly bool) DBClient { // {{{
 	//tx, err := this.db.Begin()
-	tx, err := this.db.BeginTx(context.Background(), &sql.TxOptions{
+	ctx := this.ctx
+	if nil == ctx {
+		ctx = context.Background()
+	}
+
+	tx, err := this.db.BeginTx(ctx, &sql.TxOptions{
 		ReadOnly: is_readonly,
 	})
 
@@ -105,19 +240,33 @@ func (this *MysqlClient) Begin(is_readonly bool) DBClient { // {{{
 	}
 
 	return &MysqlClient{
-		id:       this.id,
-		db:       this.db,
-		executor: &TxExecutor{tx},
-		tx:       tx,
-		intx:     true,
-		Debug:    this.Debug,
-		p:        this,
+		id:            this.id,
+		db:            this.db,
+		executor:      &TxExecutor{tx},
+		tx:            tx,
+		intx:          true,
+		afterCommit:   &[]func(){},
+		Debug:         this.Debug,
+		ConfName:      this.ConfName,
+		SlowThreshold: this.SlowThreshold,
+		SlowExplain:   this.SlowExplain,
+		QueryStats:    this.QueryStats,
+		QueryTimeout:  this.QueryTimeout,
+		requestId:     this.requestId,
+		ctx:           this.ctx,
+		timeout:       this.timeout,
+		keepNull:      this.keepNull,
+		p:             this,
 	}
 } // }}}
 
 func (this *MysqlClient) Rollback() { // {{{
 	if this.intx && nil != this.tx {
 		this.intx = false
+		if nil != this.afterCommit {
+			*this.afterCommit = nil
+		}
+
 		err := this.tx.Rollback()
 		if err != nil {
 			errorHandle(fmt.Sprintf("mysql trans rollback error:%v", err))
@@ -142,7 +291,24 @@ func (this *MysqlClient) Commit() { // {{{
 			fmt.Println("Commit transaction on #ID:", this.id)
 		}
 
+		if nil != this.afterCommit {
+			fns := *this.afterCommit
+			*this.afterCommit = nil
+			for _, fn := range fns {
+				fn()
+			}
+		}
+	}
+} // }}}
+
+//注册事务提交后执行的回调, 事务回滚时丢弃; 不在事务中时立即执行
+func (this *MysqlClient) AfterCommit(fn func()) { // {{{
+	if this.intx && nil != this.afterCommit {
+		*this.afterCommit = append(*this.afterCommit, fn)
+		return
 	}
+
+	fn()
 } // }}}
 
 //GetOne {{{
@@ -150,12 +316,12 @@ func (this *MysqlClient) GetOne(_sql string, val ...interface{}) interface{} {
 	var name string
 	var err error
 
-	var start_time time.Time
-	if this.Debug {
-		start_time = time.Now()
-	}
+	start_time := time.Now()
 
-	err = this.executor.QueryRow(_sql, val...).Scan(&name)
+	ctx, cancel := this.context()
+	defer cancel()
+
+	err = this.queryRow(ctx, _sql, val...).Scan(&name)
 	if this.Debug {
 		fmt.Println(map[string]interface{}{"tx": this.intx, "consume": time.Now().Sub(start_time).Nanoseconds() / 1000 / 1000, "sql": _sql, "val": val, "#ID": this.id})
 	}
@@ -163,9 +329,13 @@ func (this *MysqlClient) GetOne(_sql string, val ...interface{}) interface{} {
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// there were no rows, but otherwise no error occurred
+			this.track(_sql, val, start_time, 0, nil)
 		} else {
+			this.track(_sql, val, start_time, 0, err)
 			errorHandle(err)
 		}
+	} else {
+		this.track(_sql, val, start_time, 1, nil)
 	}
 
 	return name
@@ -259,13 +429,14 @@ func (this *MysqlClient) Update(table string, vals map[string]interface{}, where
 func (this *MysqlClient) getFuncParam(param interface{}) string { // {{{
 	val := fmt.Sprint(param)
 	if strings.HasPrefix(val, "#:F:#") {
-		return string([]byte(val)[6:])
+		return string([]byte(val)[5:])
 	}
 
 	return ""
 } // }}}
 
 //拼装参数时，作为可执行字符，而不是字符串值
+//param 原样拼入sql, 如: DBFuncParam("now()"), DBFuncParam("`num`+1"); 旧版本会去掉 param 的第一个字符
 func DBFuncParam(param interface{}) string { // {{{
 	val := fmt.Sprint(param)
 	if "" != val {
@@ -285,21 +456,28 @@ func (this *MysqlClient) Execute(_sql string, val ...interface{}) int {
 
 //execute {{{
 func (this *MysqlClient) execute(_sql string, val ...interface{}) (result sql.Result) {
-	var start_time time.Time
-	if this.Debug {
-		start_time = time.Now()
-	}
+	start_time := time.Now()
+
+	ctx, cancel := this.context()
+	defer cancel()
 
-	result, err := this.executor.Exec(_sql, val...)
+	result, err := this.exec(ctx, _sql, val...)
 
 	if this.Debug {
 		fmt.Println(map[string]interface{}{"tx": this.intx, "consume": time.Now().Sub(start_time).Nanoseconds() / 1000 / 1000, "sql": _sql, "val": val, "#ID": this.id})
 	}
 
 	if err != nil {
+		this.track(_sql, val, start_time, 0, err)
 		errorHandle(err)
 	}
 
+	var affect int64
+	if this.SlowThreshold > 0 || this.QueryStats {
+		affect, _ = result.RowsAffected()
+	}
+	this.track(_sql, val, start_time, affect, nil)
+
 	return result
 } // }}}
 
@@ -330,19 +508,20 @@ func (this *MysqlClient) GetAll(_sql string, val ...interface{}) []map[string]in
 		fmt.Println("")
 	}
 
-	var start_time time.Time
-	if this.Debug {
-		start_time = time.Now()
-	}
+	start_time := time.Now()
+
+	ctx, cancel := this.context()
+	defer cancel()
 
 	var rows *sql.Rows
-	rows, err := this.executor.Query(_sql, val...)
+	rows, err := this.query(ctx, _sql, val...)
 
 	if this.Debug {
 		fmt.Println(map[string]interface{}{"tx": this.intx, "consume": time.Now().Sub(start_time).Nanoseconds() / 1000 / 1000, "sql": _sql, "val": val, "#ID": this.id})
 	}
 
 	if err != nil {
+		this.track(_sql, val, start_time, 0, err)
 		errorHandle(err)
 	}
 
@@ -379,7 +558,11 @@ func (this *MysqlClient) GetAll(_sql string, val ...interface{}) []map[string]in
 		for i, col := range values {
 			// Here we can check if the value is nil (NULL value)
 			if col == nil {
-				value = ""
+				if this.keepNull {
+					value = nil
+				} else {
+					value = ""
+				}
 			} else {
 				value = string(col)
 			}
@@ -393,12 +576,161 @@ func (this *MysqlClient) GetAll(_sql string, val ...interface{}) []map[string]in
 	}
 
 	if err = rows.Err(); err != nil {
+		this.track(_sql, val, start_time, int64(j), err)
 		errorHandle(err.Error())
 	}
 
+	this.track(_sql, val, start_time, int64(j), nil)
+
 	return data
 } // }}}
 
+//查询使用的context, 超时时间优先使用 WithTimeout 设置的值, 其次为 QueryTimeout
+func (this *MysqlClient) context() (context.Context, context.CancelFunc) { // {{{
+	ctx := this.ctx
+	if nil == ctx {
+		ctx = context.Background()
+	}
+
+	timeout := this.timeout
+	if timeout <= 0 {
+		timeout = this.QueryTimeout
+	}
+
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+
+	return context.WithCancel(ctx)
+} // }}}
+
+//开启了预处理语句缓存, 且不在事务中时, 带参数的sql使用缓存的预处理语句
+//使用结束后需调用 this.stmts.release
+func (this *MysqlClient) stmt(ctx context.Context, _sql string, val []interface{}) *stmtEntry { // {{{
+	if nil == this.stmts || this.intx || 0 == len(val) {
+		return nil
+	}
+
+	entry, err := this.stmts.get(ctx, this.db, _sql)
+	if err != nil {
+		return nil
+	}
+
+	return entry
+} // }}}
+
+func (this *MysqlClient) query(ctx context.Context, _sql string, val ...interface{}) (*sql.Rows, error) { // {{{
+	if entry := this.stmt(ctx, _sql, val); nil != entry {
+		defer this.stmts.release(entry)
+		return entry.stmt.QueryContext(ctx, val...)
+	}
+
+	return this.executor.QueryContext(ctx, _sql, val...)
+} // }}}
+
+func (this *MysqlClient) queryRow(ctx context.Context, _sql string, val ...interface{}) *sql.Row { // {{{
+	if entry := this.stmt(ctx, _sql, val); nil != entry {
+		defer this.stmts.release(entry)
+		return entry.stmt.QueryRowContext(ctx, val...)
+	}
+
+	return this.executor.QueryRowContext(ctx, _sql, val...)
+} // }}}
+
+func (this *MysqlClient) exec(ctx context.Context, _sql string, val ...interface{}) (sql.Result, error) { // {{{
+	if entry := this.stmt(ctx, _sql, val); nil != entry {
+		defer this.stmts.release(entry)
+		return entry.stmt.ExecContext(ctx, val...)
+	}
+
+	return this.executor.ExecContext(ctx, _sql, val...)
+} // }}}
+
+//记录慢查询及sql统计
+func (this *MysqlClient) track(_sql string, val []interface{}, start_time time.Time, rows int64, err error) { // {{{
+	if this.SlowThreshold <= 0 && !this.QueryStats {
+		return
+	}
+
+	cost := time.Now().Sub(start_time)
+	slow := this.SlowThreshold > 0 && cost >= time.Duration(this.SlowThreshold)*time.Millisecond
+	if !slow && !this.QueryStats {
+		return
+	}
+
+	fp := Fingerprint(_sql)
+
+	if this.QueryStats {
+		queryStats.add(this.ConfName, fp, cost, rows, slow, err != nil)
+	}
+
+	if !slow {
+		return
+	}
+
+	entry := map[string]interface{}{
+		"conf":        this.ConfName,
+		"fingerprint": fp,
+		"params":      len(val),
+		"consume":     cost.Nanoseconds() / 1000 / 1000,
+		"rows":        rows,
+		"tx":          this.intx,
+		"request_id":  this.requestId,
+		"#ID":         this.id,
+	}
+
+	if err != nil {
+		entry["error"] = err.Error()
+	}
+
+	if this.SlowExplain && nil == err && strings.HasPrefix(strings.ToLower(strings.TrimSpace(_sql)), "select") {
+		entry["explain"] = this.explain(_sql, val...)
+	}
+
+	if nil != SlowLogHandler {
+		SlowLogHandler(entry)
+	} else {
+		fmt.Println("slow sql:", entry)
+	}
+} // }}}
+
+//获取explain结果, 使用连接池执行(事务中执行explain会出现'busy buffer'的错误), 出错时返回错误信息
+func (this *MysqlClient) explain(_sql string, val ...interface{}) (ret string) { // {{{
+	rows, err := this.db.Query("explain "+_sql, val...)
+	if err != nil {
+		return err.Error()
+	}
+
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err.Error()
+	}
+
+	values := make([]sql.RawBytes, len(cols))
+	scanArgs := make([]interface{}, len(values))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+
+	result := mysqlResult{}
+	for rows.Next() {
+		if err = rows.Scan(scanArgs...); err != nil {
+			return err.Error()
+		}
+
+		row := map[string]interface{}{}
+		for i, col := range values {
+			row[cols[i]] = string(col)
+		}
+
+		result = append(result, row)
+	}
+
+	return (&MysqlExplain{result}).String()
+} // }}}
+
 func errorHandle(err interface{}) { //{{{
 	fmt.Println(err)
 	panic(err)
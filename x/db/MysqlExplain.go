@@ -50,6 +50,23 @@ func (this *MysqlExplain) DrawConsole() { /*{{{*/
 	this.drawLine(arr_max_length)
 } /*}}}*/
 
+//单行文本格式, 用于写入日志, 多条记录以 | 分隔
+func (this *MysqlExplain) String() string { /*{{{*/
+	lines := []string{}
+	for _, record := range this.result {
+		items := []string{}
+		for _, v := range fields {
+			if val, ok := record[v]; ok {
+				items = append(items, v+"="+fmt.Sprint(val))
+			}
+		}
+
+		lines = append(lines, strings.Join(items, " "))
+	}
+
+	return strings.Join(lines, " | ")
+} /*}}}*/
+
 func (this *MysqlExplain) drawLine(arr_length_list []int) { /*{{{*/
 	fmt.Print("+")
 	for _, length := range arr_length_list {
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	//慢查询日志输出, 由上层(x.DBProxy)注入, 未注入时输出到控制台
+	SlowLogHandler func(entry map[string]interface{})
+
+	queryStats = &queryStatsRegistry{items: map[string]*QueryStat{}}
+
+	fpStrReg   = regexp.MustCompile(`'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"`)
+	fpNumReg   = regexp.MustCompile(`\b-?\d+(?:\.\d+)?\b`)
+	fpInReg    = regexp.MustCompile(`(?i)\bin\s*\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	fpSpaceReg = regexp.MustCompile(`\s+`)
+)
+
+//单条sql指纹的统计信息
+type QueryStat struct {
+	Conf        string        //db配置名
+	Fingerprint string        //sql指纹
+	Count       int64         //执行次数
+	SlowCount   int64         //慢查询次数
+	ErrCount    int64         //执行出错次数
+	Rows        int64         //返回或影响的总行数
+	Total       time.Duration //总耗时
+	Max         time.Duration //最大耗时
+	LastSeen    time.Time     //最后一次执行时间
+}
+
+//平均耗时
+func (this QueryStat) Avg() time.Duration { // {{{
+	if this.Count == 0 {
+		return 0
+	}
+
+	return this.Total / time.Duration(this.Count)
+} // }}}
+
+type queryStatsRegistry struct {
+	mu    sync.Mutex
+	items map[string]*QueryStat
+}
+
+func (this *queryStatsRegistry) add(conf, fp string, cost time.Duration, rows int64, slow, failed bool) { // {{{
+	key := conf + "\x00" + fp
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	st, ok := this.items[key]
+	if !ok {
+		st = &QueryStat{Conf: conf, Fingerprint: fp}
+		this.items[key] = st
+	}
+
+	st.Count++
+	st.Rows += rows
+	st.Total += cost
+	st.LastSeen = time.Now()
+	if cost > st.Max {
+		st.Max = cost
+	}
+
+	if slow {
+		st.SlowCount++
+	}
+
+	if failed {
+		st.ErrCount++
+	}
+} // }}}
+
+//获取运行时sql统计, 按总耗时倒序, 可指定db配置名过滤
+func GetQueryStats(conf_names ...string) []QueryStat { // {{{
+	queryStats.mu.Lock()
+	list := make([]QueryStat, 0, len(queryStats.items))
+	for _, st := range queryStats.items {
+		if len(conf_names) > 0 {
+			matched := false
+			for _, name := range conf_names {
+				if name == st.Conf {
+					matched = true
+					break
+				}
+			}
+
+			if !matched {
+				continue
+			}
+		}
+
+		list = append(list, *st)
+	}
+	queryStats.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Total > list[j].Total
+	})
+
+	return list
+} // }}}
+
+//清空运行时sql统计
+func ResetQueryStats() { // {{{
+	queryStats.mu.Lock()
+	queryStats.items = map[string]*QueryStat{}
+	queryStats.mu.Unlock()
+} // }}}
+
+//生成sql指纹: 参数值替换为?, in列表合并, 统一小写及空白
+//如: select * from user where uid in (1,2,3) and name='a' => select * from user where uid in (?+) and name=?
+func Fingerprint(_sql string) string { // {{{
+	fp := fpStrReg.ReplaceAllString(_sql, "?")
+	fp = fpNumReg.ReplaceAllString(fp, "?")
+	fp = fpInReg.ReplaceAllString(fp, "in (?+)")
+	fp = fpSpaceReg.ReplaceAllString(fp, " ")
+
+	return strings.ToLower(strings.TrimSpace(fp))
+} // }}}
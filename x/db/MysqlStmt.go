@@ -0,0 +1,92 @@
+package db
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"sync"
+)
+
+//预处理语句 LRU 缓存, 每个连接池一个, 超出容量时关闭最久未使用的语句
+type stmtCache struct {
+	mutex sync.Mutex
+	size  int
+	ll    *list.List
+	m     map[string]*list.Element
+}
+
+type stmtEntry struct {
+	sql     string
+	stmt    *sql.Stmt
+	refs    int  //正在使用的数量
+	evicted bool //已移出缓存, 使用结束后关闭
+}
+
+func newStmtCache(size int) *stmtCache { // {{{
+	return &stmtCache{
+		size: size,
+		ll:   list.New(),
+		m:    map[string]*list.Element{},
+	}
+} // }}}
+
+//获取预处理语句, 不存在时在连接池上预处理并缓存; 使用结束后需调用 release
+//移出缓存的语句在所有使用结束后才关闭, 避免使用前被关闭
+func (this *stmtCache) get(ctx context.Context, db *sql.DB, _sql string) (*stmtEntry, error) { // {{{
+	this.mutex.Lock()
+	if e, ok := this.m[_sql]; ok {
+		this.ll.MoveToFront(e)
+		entry := e.Value.(*stmtEntry)
+		entry.refs++
+		this.mutex.Unlock()
+		return entry, nil
+	}
+	this.mutex.Unlock()
+
+	stmt, err := db.PrepareContext(ctx, _sql)
+	if err != nil {
+		return nil, err
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	//并发预处理了同一语句
+	if e, ok := this.m[_sql]; ok {
+		this.ll.MoveToFront(e)
+		go stmt.Close()
+		entry := e.Value.(*stmtEntry)
+		entry.refs++
+		return entry, nil
+	}
+
+	entry := &stmtEntry{sql: _sql, stmt: stmt, refs: 1}
+	this.m[_sql] = this.ll.PushFront(entry)
+
+	for this.ll.Len() > this.size {
+		e := this.ll.Back()
+		old := e.Value.(*stmtEntry)
+		this.ll.Remove(e)
+		delete(this.m, old.sql)
+
+		old.evicted = true
+		if 0 == old.refs {
+			//Close 会等待已返回的 Rows 等使用结束, 所以不在锁中关闭
+			go old.stmt.Close()
+		}
+	}
+
+	return entry, nil
+} // }}}
+
+//使用结束, 已移出缓存且没有其他使用时关闭
+func (this *stmtCache) release(entry *stmtEntry) { // {{{
+	this.mutex.Lock()
+	entry.refs--
+	closable := entry.evicted && 0 == entry.refs
+	this.mutex.Unlock()
+
+	if closable {
+		go entry.stmt.Close()
+	}
+} // }}}
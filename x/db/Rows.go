@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+//逐行读取查询结果, 用于导出、批处理等不宜一次读入内存的场景
+//注意: 未Close之前, 不能在同一事务中执行其他查询; 查询超时(QueryTimeout/WithTimeout)包含读取全部记录的时间
+type RowIterator interface {
+	Next() bool                  //读取下一行, 没有更多记录时返回false并自动关闭
+	Row() map[string]interface{} //当前行, 格式同 GetAll
+	Columns() []string
+	Close()
+}
+
+type MysqlRows struct {
+	client   *MysqlClient
+	sql      string
+	val      []interface{}
+	start    time.Time
+	rows     *sql.Rows
+	cancel   context.CancelFunc
+	cols     []string
+	values   []sql.RawBytes
+	scanArgs []interface{}
+	row      map[string]interface{}
+	count    int64
+	closed   bool
+}
+
+//Rows {{{
+func (this *MysqlClient) Rows(_sql string, val ...interface{}) RowIterator {
+	start_time := time.Now()
+
+	ctx, cancel := this.context()
+	rows, err := this.query(ctx, _sql, val...)
+
+	if this.Debug {
+		fmt.Println(map[string]interface{}{"tx": this.intx, "consume": time.Now().Sub(start_time).Nanoseconds() / 1000 / 1000, "sql": _sql, "val": val, "#ID": this.id})
+	}
+
+	if err != nil {
+		cancel()
+		this.track(_sql, val, start_time, 0, err)
+		errorHandle(err)
+	}
+
+	cols, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		cancel()
+		errorHandle(err)
+	}
+
+	values := make([]sql.RawBytes, len(cols))
+	scanArgs := make([]interface{}, len(values))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+
+	return &MysqlRows{
+		client:   this,
+		sql:      _sql,
+		val:      val,
+		start:    start_time,
+		rows:     rows,
+		cancel:   cancel,
+		cols:     cols,
+		values:   values,
+		scanArgs: scanArgs,
+	}
+} // }}}
+
+//逐行回调, fn 返回false时停止读取, 返回已读取的行数
+//如: client.Each("select * from user where status=?", func(row map[string]interface{}) bool { ...; return true }, 1)
+func (this *MysqlClient) Each(_sql string, fn func(row map[string]interface{}) bool, val ...interface{}) int { // {{{
+	rows := this.Rows(_sql, val...)
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		n++
+		if !fn(rows.Row()) {
+			break
+		}
+	}
+
+	return n
+} // }}}
+
+func (this *MysqlRows) Next() bool { // {{{
+	if this.closed {
+		return false
+	}
+
+	if !this.rows.Next() {
+		err := this.rows.Err()
+		this.close(err)
+		if err != nil {
+			errorHandle(err.Error())
+		}
+
+		return false
+	}
+
+	if err := this.rows.Scan(this.scanArgs...); err != nil {
+		this.close(err)
+		errorHandle(err.Error())
+	}
+
+	row := make(map[string]interface{}, len(this.cols))
+	for i, col := range this.values {
+		if col == nil && this.client.keepNull {
+			row[this.cols[i]] = nil
+		} else if col == nil {
+			row[this.cols[i]] = ""
+		} else {
+			row[this.cols[i]] = string(col)
+		}
+	}
+
+	this.row = row
+	this.count++
+
+	return true
+} // }}}
+
+func (this *MysqlRows) Row() map[string]interface{} { // {{{
+	return this.row
+} // }}}
+
+func (this *MysqlRows) Columns() []string { // {{{
+	return this.cols
+} // }}}
+
+func (this *MysqlRows) Close() { // {{{
+	this.close(nil)
+} // }}}
+
+func (this *MysqlRows) close(err error) { // {{{
+	if this.closed {
+		return
+	}
+
+	this.closed = true
+	this.rows.Close()
+	this.cancel()
+	this.client.track(this.sql, this.val, this.start, this.count, err)
+} // }}}
@@ -45,8 +45,18 @@ var (
 	socketOrder string
 
 	hookableSignals []os.Signal
+
+	forkHooks []func()
 ) // }}}
 
+//注册 fork 子进程前执行的函数, 用于保存需要交给子进程的状态, 如本地缓存快照
+func OnFork(fn func()) { // {{{
+	runningServerReg.Lock()
+	defer runningServerReg.Unlock()
+
+	forkHooks = append(forkHooks, fn)
+} // }}}
+
 func init() { // {{{
 	runningServerReg = sync.RWMutex{}
 	runningServers = make(map[string]*endlessServer)
@@ -466,6 +476,10 @@ func (srv *endlessServer) fork() (err error) { // {{{
 
 	runningServersForked = true
 
+	for _, fn := range forkHooks {
+		fn()
+	}
+
 	var files = make([]*os.File, len(runningServers))
 	var orderArgs = make([]string, len(runningServers))
 	// get the accessor socket fds for _all_ server instances
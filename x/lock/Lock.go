@@ -0,0 +1,252 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/mlaoji/ygo/x/redis"
+	mrand "math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	DefaultTTL           = 30 * time.Second      //锁的过期时间
+	DefaultRetryDelay    = 50 * time.Millisecond //Lock 首次重试间隔, 之后每次翻倍
+	DefaultMaxRetryDelay = time.Second           //Lock 最长重试间隔
+
+	ErrNotHeld = errors.New("lock not held")
+)
+
+//基于redis的分布式锁
+//传入多个 redis 实例时使用 Redlock 算法, 超过半数实例加锁成功且剩余有效期大于0时视为成功
+//用法:
+//  m := lock.New("job:daily", rc)
+//  if err := m.Lock(ctx); err != nil {
+//      return
+//  }
+//  defer m.Unlock()
+func New(key string, rc *redis.RedisClient, options ...FuncLockOption) *Mutex { // {{{
+	return NewMulti(key, []*redis.RedisClient{rc}, options...)
+} // }}}
+
+//Redlock 模式, clients 为相互独立的 redis 实例
+func NewMulti(key string, clients []*redis.RedisClient, options ...FuncLockOption) *Mutex { // {{{
+	m := &Mutex{
+		Key:           key,
+		TTL:           DefaultTTL,
+		RetryDelay:    DefaultRetryDelay,
+		MaxRetryDelay: DefaultMaxRetryDelay,
+		AutoRenew:     true,
+		clients:       clients,
+	}
+
+	for _, opt := range options {
+		opt(m)
+	}
+
+	return m
+} // }}}
+
+type FuncLockOption func(m *Mutex)
+
+//New 设置参数 TTL, 锁的过期时间
+func WithTTL(ttl time.Duration) FuncLockOption { // {{{
+	return func(m *Mutex) {
+		if ttl > 0 {
+			m.TTL = ttl
+		}
+	}
+} // }}}
+
+//New 设置参数 RetryDelay 及 MaxRetryDelay, Lock 获取失败时的重试间隔
+func WithRetryDelay(delay, max_delay time.Duration) FuncLockOption { // {{{
+	return func(m *Mutex) {
+		if delay > 0 {
+			m.RetryDelay = delay
+		}
+
+		if max_delay >= m.RetryDelay {
+			m.MaxRetryDelay = max_delay
+		}
+	}
+} // }}}
+
+//New 设置参数 AutoRenew, 持有锁期间是否每 TTL/3 自动续期, 默认开启
+func WithAutoRenew(renew bool) FuncLockOption { // {{{
+	return func(m *Mutex) {
+		m.AutoRenew = renew
+	}
+} // }}}
+
+type Mutex struct {
+	Key           string
+	TTL           time.Duration
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	AutoRenew     bool
+
+	clients []*redis.RedisClient
+	mutex   sync.Mutex
+	token   string
+	lost    chan struct{}
+	stop    chan struct{}
+}
+
+//阻塞获取锁, 直到成功或 ctx 结束
+func (this *Mutex) Lock(ctx context.Context) error { // {{{
+	delay := this.RetryDelay
+	for {
+		ok, err := this.TryLock()
+		if ok {
+			return nil
+		}
+
+		//加锁出错(如网络错误)时同样重试, ctx 结束时返回最后一次的错误
+		wait := delay/2 + time.Duration(mrand.Int63n(int64(delay)))
+		select {
+		case <-ctx.Done():
+			if nil != err {
+				return err
+			}
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		if delay *= 2; delay > this.MaxRetryDelay {
+			delay = this.MaxRetryDelay
+		}
+	}
+} // }}}
+
+//尝试获取锁一次, 已被其他持有者占用时返回 false
+func (this *Mutex) TryLock() (bool, error) { // {{{
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if "" != this.token {
+		return false, errors.New("lock already held by this mutex")
+	}
+
+	token := newToken()
+	start := time.Now()
+
+	var err error
+	n := 0
+	for _, rc := range this.clients {
+		ok, e := acquire(rc, this.Key, token, this.TTL)
+		if ok {
+			n++
+		} else if nil != e {
+			err = e
+		}
+	}
+
+	//扣除加锁耗时及时钟漂移后的剩余有效期
+	validity := this.TTL - time.Since(start) - this.TTL/100 - 2*time.Millisecond
+	if n < this.quorum() || validity <= 0 {
+		this.release(token)
+		return false, err
+	}
+
+	this.token = token
+	this.lost = make(chan struct{})
+	if this.AutoRenew {
+		this.stop = make(chan struct{})
+		go this.renew(token, this.stop, this.lost)
+	}
+
+	return true, nil
+} // }}}
+
+//释放锁, 只删除本次加锁的token对应的key, 锁已过期或被他人持有时返回 ErrNotHeld
+func (this *Mutex) Unlock() error { // {{{
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if "" == this.token {
+		return ErrNotHeld
+	}
+
+	if nil != this.stop {
+		close(this.stop)
+		this.stop = nil
+	}
+
+	token := this.token
+	this.token = ""
+
+	if this.release(token) < this.quorum() {
+		return ErrNotHeld
+	}
+
+	return nil
+} // }}}
+
+//当前加锁的token, 未持有锁时为空
+func (this *Mutex) Token() string { // {{{
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return this.token
+} // }}}
+
+//自动续期失败(锁已丢失)时关闭, 持有锁期间执行的任务可监听此通道以便及时中止
+func (this *Mutex) Lost() <-chan struct{} { // {{{
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return this.lost
+} // }}}
+
+func (this *Mutex) quorum() int { // {{{
+	return len(this.clients)/2 + 1
+} // }}}
+
+func (this *Mutex) release(token string) int { // {{{
+	n := 0
+	for _, rc := range this.clients {
+		if ok, _ := rc.CompareAndDelete(this.Key, token); ok {
+			n++
+		}
+	}
+
+	return n
+} // }}}
+
+func (this *Mutex) renew(token string, stop, lost chan struct{}) { // {{{
+	ticker := time.NewTicker(this.TTL / 3)
+	defer ticker.Stop()
+
+	ms := int(this.TTL / time.Millisecond)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			n := 0
+			for _, rc := range this.clients {
+				if ok, _ := rc.CompareAndPexpire(this.Key, token, ms); ok {
+					n++
+				}
+			}
+
+			if n < this.quorum() {
+				close(lost)
+				return
+			}
+		}
+	}
+} // }}}
+
+func acquire(rc *redis.RedisClient, key, token string, ttl time.Duration) (bool, error) { // {{{
+	return rc.SetOpt(key, token, redis.SetOption{NX: true, PX: int(ttl / time.Millisecond)})
+} // }}}
+
+func newToken() string { // {{{
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+} // }}}
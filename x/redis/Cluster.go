@@ -0,0 +1,77 @@
+package redis
+
+import (
+	"github.com/mediocregopher/radix.v2/cluster"
+)
+
+//按slot对key分组, 保持key在组内的原有顺序
+func groupBySlot(keys []string) map[uint16][]string { // {{{
+	groups := map[uint16][]string{}
+	for _, key := range keys {
+		slot := cluster.Slot(key)
+		groups[slot] = append(groups[slot], key)
+	}
+
+	return groups
+} // }}}
+
+//key 是否都在同一slot, 用于结果不能按slot分组合并的多key命令(如 PFCOUNT, PFMERGE)
+func sameSlot(keys []string) bool { // {{{
+	for i := 1; i < len(keys); i++ {
+		if cluster.Slot(keys[i]) != cluster.Slot(keys[0]) {
+			return false
+		}
+	}
+
+	return true
+} // }}}
+
+//按slot分组执行 MGET, 再按传入顺序组装结果
+func (this *RedisClient) clusterMget(keys []string) ([]string, error) { // {{{
+	vals := make(map[string]string, len(keys))
+	for _, group := range groupBySlot(keys) {
+		list, err := this.cmd("MGET", group).List()
+		if err != nil {
+			return nil, err
+		}
+
+		for i, key := range group {
+			if i < len(list) {
+				vals[key] = list[i]
+			}
+		}
+	}
+
+	val := make([]string, len(keys))
+	for i, key := range keys {
+		val[i] = vals[key]
+	}
+
+	return val, nil
+} // }}}
+
+//在每个 master 上执行 KEYS 并合并结果
+func (this *RedisClient) clusterKeys(pattern string) ([]string, error) { // {{{
+	clients, err := this._cluster.GetEvery()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		for _, c := range clients {
+			this._cluster.Put(c)
+		}
+	}()
+
+	val := []string{}
+	for _, c := range clients {
+		list, err := c.Cmd("KEYS", pattern).List()
+		if err != nil {
+			return nil, err
+		}
+
+		val = append(val, list...)
+	}
+
+	return val, nil
+} // }}}
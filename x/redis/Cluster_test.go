@@ -0,0 +1,267 @@
+package redis
+
+import (
+	"fmt"
+	"github.com/mediocregopher/radix.v2/cluster"
+	"github.com/mediocregopher/radix.v2/redis"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGroupBySlot(t *testing.T) { // {{{
+	keys := []string{"{u}:3", "a", "{u}:1", "b", "{u}:2"}
+	groups := groupBySlot(keys)
+
+	//同一 hash tag 的key在同一组, 并保持传入顺序
+	want := []string{"{u}:3", "{u}:1", "{u}:2"}
+	if got := groups[cluster.Slot("{u}")]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("group of {u} = %v, want %v", got, want)
+	}
+
+	n := 0
+	for slot, group := range groups {
+		for _, key := range group {
+			if cluster.Slot(key) != slot {
+				t.Fatalf("key %s in group of slot %d", key, slot)
+			}
+		}
+		n += len(group)
+	}
+
+	if len(keys) != n {
+		t.Fatalf("grouped %d keys, want %d", n, len(keys))
+	}
+} // }}}
+
+func TestSameSlot(t *testing.T) { // {{{
+	if !sameSlot(nil) || !sameSlot([]string{"a"}) {
+		t.Fatal("empty or single key should be in the same slot")
+	}
+
+	if !sameSlot([]string{"{uv}:a", "{uv}:b", "prefix:{uv}"}) {
+		t.Fatal("keys with the same hash tag should be in the same slot")
+	}
+
+	if cluster.Slot("a") != cluster.Slot("b") && sameSlot([]string{"a", "b"}) {
+		t.Fatal("keys a and b should not be in the same slot")
+	}
+} // }}}
+
+func TestUnknownMode(t *testing.T) { // {{{
+	if _, err := NewRedisClient("127.0.0.1:6379", "", WithMode("unknown")); nil == err {
+		t.Fatal("Init should fail for an unknown mode")
+	}
+} // }}}
+
+//以下测试需要 redis-server, 不存在时跳过
+
+//启动一个 redis-server, 返回地址, 测试结束时关闭
+func startRedis(t *testing.T, args ...string) string { // {{{
+	t.Helper()
+
+	bin, err := exec.LookPath("redis-server")
+	if nil != err {
+		t.Skip("redis-server not found in $PATH")
+	}
+
+	port := freePort(t)
+	dir := t.TempDir()
+	args = append([]string{"--port", fmt.Sprint(port), "--bind", "127.0.0.1", "--dir", dir, "--save", "", "--appendonly", "no"}, args...)
+
+	cmd := exec.Command(bin, args...)
+	if err = cmd.Start(); nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	waitRedis(t, addr)
+
+	return addr
+} // }}}
+
+func freePort(t *testing.T) int { // {{{
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port
+} // }}}
+
+func waitRedis(t *testing.T, addr string) { // {{{
+	for i := 0; i < 100; i++ {
+		if c, err := redis.DialTimeout("tcp", addr, time.Second); nil == err {
+			err = c.Cmd("PING").Err
+			c.Close()
+			if nil == err {
+				return
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	t.Fatalf("redis %s not ready", addr)
+} // }}}
+
+//启动3个节点并分配全部slot, 返回逗号分隔的节点地址
+func startCluster(t *testing.T) string { // {{{
+	addrs := []string{}
+	for i := 0; i < 3; i++ {
+		addrs = append(addrs, startRedis(t, "--cluster-enabled", "yes", "--cluster-config-file", "nodes.conf"))
+	}
+
+	clients := []*redis.Client{}
+	for _, addr := range addrs {
+		c, err := redis.Dial("tcp", addr)
+		if nil != err {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		clients = append(clients, c)
+	}
+
+	ranges := [][2]int{{0, 5460}, {5461, 10922}, {10923, 16383}}
+	for i, c := range clients {
+		slots := []interface{}{}
+		for s := ranges[i][0]; s <= ranges[i][1]; s++ {
+			slots = append(slots, s)
+		}
+
+		if err := c.Cmd("CLUSTER", "ADDSLOTS", slots).Err; nil != err {
+			t.Fatal(err)
+		}
+
+		if i > 0 {
+			host, port, _ := net.SplitHostPort(addrs[0])
+			if err := c.Cmd("CLUSTER", "MEET", host, port).Err; nil != err {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for i := 0; i < 200; i++ {
+		ok := true
+		for _, c := range clients {
+			info, _ := c.Cmd("CLUSTER", "INFO").Str()
+			if !strings.Contains(info, "cluster_state:ok") || !strings.Contains(info, "cluster_known_nodes:3") {
+				ok = false
+				break
+			}
+		}
+
+		if ok {
+			return strings.Join(addrs, ",")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	t.Fatal("redis cluster not ready")
+	return ""
+} // }}}
+
+func TestClusterMode(t *testing.T) { // {{{
+	hosts := startCluster(t)
+
+	rc, err := NewRedisClient(hosts, "", WithMode(MODE_CLUSTER), WithPrefix("t:"))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+	for _, key := range keys {
+		if err = rc.Set(key, "v"+key); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	//结果按传入顺序返回, 不存在的key为空字符串
+	vals, err := rc.Mget([]string{"f", "a", "x", "c"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if want := []string{"vf", "va", "", "vc"}; !reflect.DeepEqual(vals, want) {
+		t.Fatalf("Mget = %v, want %v", vals, want)
+	}
+
+	//各节点的结果合并, 并去掉前缀
+	list, err := rc.Keys("*")
+	if nil != err {
+		t.Fatal(err)
+	}
+	sort.Strings(list)
+	if !reflect.DeepEqual(list, keys) {
+		t.Fatalf("Keys = %v, want %v", list, keys)
+	}
+
+	if _, err = rc.Pfcount("a", "b"); cluster.Slot("t:a") != cluster.Slot("t:b") && ErrCrossSlot != err {
+		t.Fatalf("Pfcount across slots err = %v, want ErrCrossSlot", err)
+	}
+
+	if _, err = rc.Pfcount("{uv}:a", "{uv}:b"); nil != err {
+		t.Fatalf("Pfcount in the same slot err = %v", err)
+	}
+
+	if err = rc.DelAll(keys); nil != err {
+		t.Fatal(err)
+	}
+	if list, _ = rc.Keys("*"); 0 != len(list) {
+		t.Fatalf("Keys after DelAll = %v", list)
+	}
+} // }}}
+
+func TestSentinelMode(t *testing.T) { // {{{
+	master := startRedis(t)
+
+	host, port, _ := net.SplitHostPort(master)
+	conf := filepath.Join(t.TempDir(), "sentinel.conf")
+	if err := ioutil.WriteFile(conf, []byte("sentinel monitor mymaster "+host+" "+port+" 1\n"), 0644); nil != err {
+		t.Fatal(err)
+	}
+
+	//redis-server 以 --sentinel 启动时, 第一个参数须为配置文件
+	bin, _ := exec.LookPath("redis-server")
+	sentinel_port := freePort(t)
+	cmd := exec.Command(bin, conf, "--sentinel", "--port", fmt.Sprint(sentinel_port), "--bind", "127.0.0.1")
+	if err := cmd.Start(); nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	sentinel_addr := fmt.Sprintf("127.0.0.1:%d", sentinel_port)
+	waitRedis(t, sentinel_addr)
+
+	rc, err := NewRedisClient(sentinel_addr, "", WithMode(MODE_SENTINEL), WithMasterName("mymaster"))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if err = rc.Set("k", "v"); nil != err {
+		t.Fatal(err)
+	}
+
+	//写入的是 sentinel 返回的 master
+	c, err := redis.Dial("tcp", master)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if v, _ := c.Cmd("GET", "k").Str(); "v" != v {
+		t.Fatalf("GET k on master = %q, want v", v)
+	}
+} // }}}
@@ -0,0 +1,132 @@
+package redis
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"github.com/mediocregopher/radix.v2/redis"
+	"sync"
+)
+
+//值的编码方式, 用于直接保存和读取结构体等类型
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	CodecJSON Codec = jsonCodec{}
+	CodecGob  Codec = gobCodec{}
+
+	codecs     = map[string]Codec{"json": CodecJSON, "gob": CodecGob}
+	codecMutex sync.RWMutex
+)
+
+//注册编码方式, 可通过名字在配置中使用
+func RegisterCodec(name string, codec Codec) { // {{{
+	codecMutex.Lock()
+	defer codecMutex.Unlock()
+
+	codecs[name] = codec
+} // }}}
+
+//按名字获取编码方式, 内置: json, gob, msgpack(使用 nomsgpack 编译时不可用)
+func GetCodec(name string) Codec { // {{{
+	codecMutex.RLock()
+	defer codecMutex.RUnlock()
+
+	return codecs[name]
+} // }}}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { // {{{
+	return json.Marshal(v)
+} // }}}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { // {{{
+	return json.Unmarshal(data, v)
+} // }}}
+
+//gob 编码, 只能由 go 程序读取, 保存接口类型的值时需先 gob.Register 具体类型
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) { // {{{
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+} // }}}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error { // {{{
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+} // }}}
+
+//按 Codec 编码保存, expire > 0 时设置过期时间(秒)
+func (this *RedisClient) SetValue(key string, v interface{}, expire int) error { // {{{
+	return this.setValue(this.Codec, key, v, expire)
+} // }}}
+
+//读取按 Codec 编码的值并解码到 v(指针), 返回key是否存在
+func (this *RedisClient) GetValue(key string, v interface{}) (bool, error) { // {{{
+	return this.getValue(this.Codec, key, v)
+} // }}}
+
+//按 Codec 编码保存到 hash 的 field
+func (this *RedisClient) HsetValue(key string, field interface{}, v interface{}) error { // {{{
+	b, err := this.codec(this.Codec).Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return this.cmd("HSET", this.Key(key), field, b).Err
+} // }}}
+
+//读取 hash 中按 Codec 编码的 field, 返回 field 是否存在
+func (this *RedisClient) HgetValue(key string, field interface{}, v interface{}) (bool, error) { // {{{
+	return this.decode(this.Codec, this.cmd("HGET", this.Key(key), field), v)
+} // }}}
+
+func (this *RedisClient) codec(c Codec) Codec { // {{{
+	if nil == c {
+		return CodecJSON
+	}
+
+	return c
+} // }}}
+
+func (this *RedisClient) setValue(c Codec, key string, v interface{}, expire int) error { // {{{
+	b, err := this.codec(c).Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if expire > 0 {
+		return this.cmd("SETEX", this.Key(key), expire, b).Err
+	}
+
+	return this.cmd("SET", this.Key(key), b).Err
+} // }}}
+
+func (this *RedisClient) getValue(c Codec, key string, v interface{}) (bool, error) { // {{{
+	return this.decode(c, this.cmd("GET", this.Key(key)), v)
+} // }}}
+
+func (this *RedisClient) decode(c Codec, r *redis.Resp, v interface{}) (bool, error) { // {{{
+	if nil != r.Err {
+		return false, r.Err
+	}
+
+	if r.IsType(redis.Nil) {
+		return false, nil
+	}
+
+	b, err := r.Bytes()
+	if err != nil {
+		return false, err
+	}
+
+	return true, this.codec(c).Unmarshal(b, v)
+} // }}}
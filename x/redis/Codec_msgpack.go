@@ -0,0 +1,25 @@
+//go:build !nomsgpack
+// +build !nomsgpack
+
+package redis
+
+import (
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+//msgpack 编码, 比 JSON 更紧凑; 使用 nomsgpack 编译时不可用
+var CodecMsgpack Codec = msgpackCodec{}
+
+func init() {
+	RegisterCodec("msgpack", CodecMsgpack)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) { // {{{
+	return msgpack.Marshal(v)
+} // }}}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error { // {{{
+	return msgpack.Unmarshal(data, v)
+} // }}}
@@ -0,0 +1,388 @@
+package redis
+
+import (
+	"errors"
+	"github.com/mediocregopher/radix.v2/redis"
+)
+
+var (
+	DefaultTxRetries = 3 //WATCH 的key被修改导致事务失败时的重试次数
+
+	ErrPipeNotExecuted = errors.New("redis pipeline not executed")
+	ErrTxFailed        = errors.New("redis transaction failed: watched keys changed")
+)
+
+//从连接池取出一个连接, cluster 模式下取 key 所在节点的连接
+func (this *RedisClient) getConn(key string) (*redis.Client, error) { // {{{
+	switch this.Mode {
+	case MODE_CLUSTER:
+		return this._cluster.GetForKey(key)
+	case MODE_SENTINEL:
+		return this._sentinel.GetMaster(this.MasterName)
+	}
+
+	return this._pool.Get()
+} // }}}
+
+func (this *RedisClient) putConn(c *redis.Client) { // {{{
+	switch this.Mode {
+	case MODE_CLUSTER:
+		this._cluster.Put(c)
+	case MODE_SENTINEL:
+		this._sentinel.PutMaster(this.MasterName, c)
+	default:
+		this._pool.Put(c)
+	}
+} // }}}
+
+//管道, 命令在 Exec 时通过同一连接一次性发送, 结果在 Exec 后通过各命令返回的 *Result 获取
+//cluster 模式下所有key须在同一slot(可使用 {tag} 形式的key)
+//用法:
+//  p := rc.Pipeline()
+//  a := p.Get("a")
+//  p.Hset("h", "f", 1)
+//  err := p.Exec()
+//  val, err := a.Str()
+func (this *RedisClient) Pipeline() *Pipeline { // {{{
+	return &Pipeline{rc: this, cmdQueue: cmdQueue{prefix: this.Prefix}}
+} // }}}
+
+type Pipeline struct {
+	cmdQueue
+	rc *RedisClient
+}
+
+//Pipeline 与 Tx 共用的命令队列
+type cmdQueue struct {
+	cmds   []*pipeCmd
+	prefix string
+}
+
+type pipeCmd struct {
+	cmd    string
+	args   []interface{}
+	result *Result
+}
+
+//命令的执行结果, 用于 Pipeline, Tx 及 Lua 脚本
+type Result struct {
+	resp *redis.Resp
+}
+
+func (this *Result) Resp() *redis.Resp { // {{{
+	if nil == this.resp {
+		return redis.NewResp(ErrPipeNotExecuted)
+	}
+
+	return this.resp
+} // }}}
+
+func (this *Result) Err() error { // {{{
+	return this.Resp().Err
+} // }}}
+
+//结果为nil(如key不存在)
+func (this *Result) IsNil() bool { // {{{
+	return this.Resp().IsType(redis.Nil)
+} // }}}
+
+func (this *Result) Str() (string, error) { // {{{
+	if this.IsNil() {
+		return "", nil
+	}
+
+	return this.Resp().Str()
+} // }}}
+
+func (this *Result) Bytes() ([]byte, error) { // {{{
+	if this.IsNil() {
+		return nil, nil
+	}
+
+	return this.Resp().Bytes()
+} // }}}
+
+func (this *Result) Int() (int, error) { // {{{
+	if this.IsNil() {
+		return 0, nil
+	}
+
+	return this.Resp().Int()
+} // }}}
+
+func (this *Result) Int64() (int64, error) { // {{{
+	if this.IsNil() {
+		return 0, nil
+	}
+
+	return this.Resp().Int64()
+} // }}}
+
+func (this *Result) Float64() (float64, error) { // {{{
+	if this.IsNil() {
+		return 0, nil
+	}
+
+	return this.Resp().Float64()
+} // }}}
+
+func (this *Result) Bool() (bool, error) { // {{{
+	val, err := this.Int()
+	return val > 0, err
+} // }}}
+
+func (this *Result) List() ([]string, error) { // {{{
+	if this.IsNil() {
+		return nil, nil
+	}
+
+	return this.Resp().List()
+} // }}}
+
+func (this *Result) Map() (map[string]string, error) { // {{{
+	if this.IsNil() {
+		return nil, nil
+	}
+
+	return this.Resp().Map()
+} // }}}
+
+//添加命令到管道, 参数原样发送, 不添加key前缀
+func (this *cmdQueue) Cmd(cmd string, args ...interface{}) *Result { // {{{
+	r := &Result{}
+	this.cmds = append(this.cmds, &pipeCmd{cmd: cmd, args: args, result: r})
+
+	return r
+} // }}}
+
+//管道中的命令数
+func (this *cmdQueue) Len() int { // {{{
+	return len(this.cmds)
+} // }}}
+
+//发送管道中的全部命令, 返回第一个执行失败的命令的错误; 执行后管道清空, 可继续添加命令
+func (this *Pipeline) Exec() error { // {{{
+	if len(this.cmds) == 0 {
+		return nil
+	}
+
+	c, err := this.rc.getConn(this.key())
+	if err != nil {
+		return err
+	}
+	defer this.rc.putConn(c)
+
+	return this.exec(c)
+} // }}}
+
+func (this *Pipeline) exec(c *redis.Client) (err error) { // {{{
+	cmds := this.cmds
+	this.cmds = nil
+
+	for _, pc := range cmds {
+		c.PipeAppend(pc.cmd, pc.args...)
+	}
+
+	for _, pc := range cmds {
+		pc.result.resp = c.PipeResp()
+		if nil == err && nil != pc.result.resp.Err {
+			err = pc.result.resp.Err
+		}
+	}
+
+	return
+} // }}}
+
+//第一个命令的key, 用于 cluster 模式下选择节点
+func (this *Pipeline) key() string { // {{{
+	for _, pc := range this.cmds {
+		if key, err := redis.KeyFromArgs(pc.args...); nil == err {
+			return key
+		}
+	}
+
+	return ""
+} // }}}
+
+func (this *cmdQueue) Set(key string, val interface{}) *Result { // {{{
+	return this.Cmd("SET", this.prefix+key, val)
+} // }}}
+
+func (this *cmdQueue) Setex(key string, secs int, val interface{}) *Result { // {{{
+	return this.Cmd("SETEX", this.prefix+key, secs, val)
+} // }}}
+
+func (this *cmdQueue) Get(key string) *Result { // {{{
+	return this.Cmd("GET", this.prefix+key)
+} // }}}
+
+func (this *cmdQueue) Del(key string) *Result { // {{{
+	return this.Cmd("DEL", this.prefix+key)
+} // }}}
+
+func (this *cmdQueue) Exists(key string) *Result { // {{{
+	return this.Cmd("EXISTS", this.prefix+key)
+} // }}}
+
+func (this *cmdQueue) Expire(key string, expire int) *Result { // {{{
+	return this.Cmd("EXPIRE", this.prefix+key, expire)
+} // }}}
+
+func (this *cmdQueue) Incrby(key string, increment int) *Result { // {{{
+	return this.Cmd("INCRBY", this.prefix+key, increment)
+} // }}}
+
+func (this *cmdQueue) Hset(key string, field interface{}, val interface{}) *Result { // {{{
+	return this.Cmd("HSET", this.prefix+key, field, val)
+} // }}}
+
+func (this *cmdQueue) Hmset(key string, val interface{}) *Result { // {{{
+	return this.Cmd("HMSET", this.prefix+key, val)
+} // }}}
+
+func (this *cmdQueue) Hget(key string, field interface{}) *Result { // {{{
+	return this.Cmd("HGET", this.prefix+key, field)
+} // }}}
+
+func (this *cmdQueue) HgetAll(key string) *Result { // {{{
+	return this.Cmd("HGETALL", this.prefix+key)
+} // }}}
+
+func (this *cmdQueue) Hdel(key string, field interface{}) *Result { // {{{
+	return this.Cmd("HDEL", this.prefix+key, field)
+} // }}}
+
+func (this *cmdQueue) Hincrby(key string, field interface{}, increment int) *Result { // {{{
+	return this.Cmd("HINCRBY", this.prefix+key, field, increment)
+} // }}}
+
+func (this *cmdQueue) Rpush(key string, val interface{}) *Result { // {{{
+	return this.Cmd("RPUSH", this.prefix+key, val)
+} // }}}
+
+func (this *cmdQueue) Lpush(key string, val interface{}) *Result { // {{{
+	return this.Cmd("LPUSH", this.prefix+key, val)
+} // }}}
+
+func (this *cmdQueue) Sadd(key string, val interface{}) *Result { // {{{
+	return this.Cmd("SADD", this.prefix+key, val)
+} // }}}
+
+func (this *cmdQueue) Srem(key string, member interface{}) *Result { // {{{
+	return this.Cmd("SREM", this.prefix+key, member)
+} // }}}
+
+func (this *cmdQueue) Zadd(key string, score interface{}, val interface{}) *Result { // {{{
+	return this.Cmd("ZADD", this.prefix+key, score, val)
+} // }}}
+
+func (this *cmdQueue) Zrem(key string, member interface{}) *Result { // {{{
+	return this.Cmd("ZREM", this.prefix+key, member)
+} // }}}
+
+//乐观事务, 在同一连接上 WATCH keys 后执行 fn, fn 中通过 tx.Do 读取数据, 通过 tx.Cmd/tx.Set 等添加事务中的命令, fn 返回后以 MULTI/EXEC 提交
+//WATCH 的key在提交前被修改时重新执行 fn, 最多重试 DefaultTxRetries 次, 仍失败返回 ErrTxFailed; fn 返回错误时放弃事务并返回该错误
+//用法:
+//  err := rc.Tx(func(tx *redis.Tx) error {
+//      n, _ := tx.Do("GET", rc.Key(key)).Int()
+//      tx.Set(key, n+1)
+//      return nil
+//  }, key)
+func (this *RedisClient) Tx(fn func(tx *Tx) error, keys ...string) (err error) { // {{{
+	keys = this.prefixKeys(keys)
+	key := ""
+	if len(keys) > 0 {
+		key = keys[0]
+	}
+
+	c, err := this.getConn(key)
+	if err != nil {
+		return err
+	}
+	defer this.putConn(c)
+
+	for i := 0; i <= DefaultTxRetries; i++ {
+		err = this.tx(c, fn, keys)
+		if ErrTxFailed != err || len(keys) == 0 {
+			return
+		}
+	}
+
+	return
+} // }}}
+
+func (this *RedisClient) tx(c *redis.Client, fn func(tx *Tx) error, keys []string) (err error) { // {{{
+	if len(keys) > 0 {
+		if err = c.Cmd("WATCH", keys).Err; err != nil {
+			return
+		}
+	}
+
+	t := &Tx{c: c, cmdQueue: cmdQueue{prefix: this.Prefix}}
+
+	if err = fn(t); err != nil {
+		if len(keys) > 0 {
+			c.Cmd("UNWATCH")
+		}
+		return
+	}
+
+	if len(t.cmds) == 0 {
+		if len(keys) > 0 {
+			err = c.Cmd("UNWATCH").Err
+		}
+		return
+	}
+
+	cmds := t.cmds
+	t.cmds = nil
+
+	c.PipeAppend("MULTI")
+	for _, pc := range cmds {
+		c.PipeAppend(pc.cmd, pc.args...)
+	}
+	c.PipeAppend("EXEC")
+
+	//MULTI 及各命令的 QUEUED 响应, 命令有误时 EXEC 返回 EXECABORT
+	for i := 0; i <= len(cmds); i++ {
+		if r := c.PipeResp(); nil == err && nil != r.Err {
+			err = r.Err
+		}
+	}
+
+	r := c.PipeResp()
+	if nil != r.Err {
+		return r.Err
+	}
+
+	if r.IsType(redis.Nil) {
+		return ErrTxFailed
+	}
+
+	list, err := r.Array()
+	if err != nil {
+		return err
+	}
+
+	for i, pc := range cmds {
+		if i < len(list) {
+			pc.result.resp = list[i]
+			if nil == err && nil != list[i].Err {
+				err = list[i].Err
+			}
+		}
+	}
+
+	return
+} // }}}
+
+//事务, 由 RedisClient.Tx 创建
+type Tx struct {
+	cmdQueue
+	c *redis.Client
+}
+
+//在事务所在连接上立即执行命令, 用于 WATCH 后读取数据, 不添加key前缀, 需通过 RedisClient.Key 获取完整key
+func (this *Tx) Do(cmd string, args ...interface{}) *redis.Resp { // {{{
+	return this.c.Cmd(cmd, args...)
+} // }}}
@@ -0,0 +1,366 @@
+package redis
+
+import (
+	"fmt"
+	"github.com/mediocregopher/radix.v2/pubsub"
+	"github.com/mediocregopher/radix.v2/redis"
+	"sync"
+	"time"
+)
+
+//发布消息, 返回收到消息的订阅者数量
+func (this *RedisClient) Publish(channel string, msg interface{}) (int, error) { // {{{
+	return this.cmd("PUBLISH", channel, msg).Int()
+} // }}}
+
+//订阅收到的消息
+type PubSubMessage struct {
+	Channel string
+	Pattern string //通过 PSubscribe 订阅时匹配的模式
+	Message string
+}
+
+type PubSubHandler func(msg *PubSubMessage)
+
+//创建订阅者, 使用独占连接, 连接断开后自动重连并重新订阅, 消息由固定数量的协程调用处理函数
+//用法:
+//  sub := rc.NewSubscriber(redis.WithSubWorkers(4))
+//  sub.Subscribe(func(msg *redis.PubSubMessage) { ... }, "news")
+//  sub.PSubscribe(func(msg *redis.PubSubMessage) { ... }, "user:*")
+//  sub.Start()
+//  ...
+//  sub.Stop()
+func (this *RedisClient) NewSubscriber(options ...FuncSubOption) *Subscriber { // {{{
+	s := &Subscriber{
+		rc:            this,
+		Workers:       1,
+		QueueSize:     100,
+		PingInterval:  30 * time.Second,
+		MinRetryDelay: 100 * time.Millisecond,
+		MaxRetryDelay: 10 * time.Second,
+		channels:      map[string]PubSubHandler{},
+		patterns:      map[string]PubSubHandler{},
+		stop:          make(chan struct{}),
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+} // }}}
+
+type FuncSubOption func(s *Subscriber)
+
+//NewSubscriber 设置参数 Workers, 执行处理函数的协程数
+func WithSubWorkers(n int) FuncSubOption { // {{{
+	return func(s *Subscriber) {
+		if n > 0 {
+			s.Workers = n
+		}
+	}
+} // }}}
+
+//NewSubscriber 设置参数 QueueSize, 待处理消息队列长度, 队列满时暂停读取
+func WithSubQueueSize(size int) FuncSubOption { // {{{
+	return func(s *Subscriber) {
+		if size >= 0 {
+			s.QueueSize = size
+		}
+	}
+} // }}}
+
+//NewSubscriber 设置参数 PingInterval, 没有消息时发送 PING 检测连接的间隔
+func WithSubPingInterval(interval time.Duration) FuncSubOption { // {{{
+	return func(s *Subscriber) {
+		if interval > 0 {
+			s.PingInterval = interval
+		}
+	}
+} // }}}
+
+//NewSubscriber 设置参数 MinRetryDelay 及 MaxRetryDelay, 重连间隔从 MinRetryDelay 开始每次翻倍, 最长 MaxRetryDelay
+func WithSubRetryDelay(min_delay, max_delay time.Duration) FuncSubOption { // {{{
+	return func(s *Subscriber) {
+		if min_delay > 0 {
+			s.MinRetryDelay = min_delay
+		}
+
+		if max_delay >= s.MinRetryDelay {
+			s.MaxRetryDelay = max_delay
+		}
+	}
+} // }}}
+
+//NewSubscriber 设置参数 OnError, 连接出错及处理函数 panic 时调用
+func WithSubErrorHandler(fn func(err error)) FuncSubOption { // {{{
+	return func(s *Subscriber) {
+		s.OnError = fn
+	}
+} // }}}
+
+type Subscriber struct {
+	Workers       int
+	QueueSize     int
+	PingInterval  time.Duration
+	MinRetryDelay time.Duration
+	MaxRetryDelay time.Duration
+	OnError       func(err error)
+
+	rc       *RedisClient
+	mutex    sync.Mutex
+	channels map[string]PubSubHandler
+	patterns map[string]PubSubHandler
+	conn     *redis.Client
+	started  bool
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+//订阅频道, 运行中订阅时会重新建立连接, 期间的消息可能丢失
+func (this *Subscriber) Subscribe(fn PubSubHandler, channels ...string) { // {{{
+	this.mutex.Lock()
+	for _, ch := range channels {
+		this.channels[ch] = fn
+	}
+	this.mutex.Unlock()
+
+	this.resubscribe()
+} // }}}
+
+//按模式订阅, 如 news.*
+func (this *Subscriber) PSubscribe(fn PubSubHandler, patterns ...string) { // {{{
+	this.mutex.Lock()
+	for _, p := range patterns {
+		this.patterns[p] = fn
+	}
+	this.mutex.Unlock()
+
+	this.resubscribe()
+} // }}}
+
+//取消订阅频道或模式
+func (this *Subscriber) Unsubscribe(names ...string) { // {{{
+	this.mutex.Lock()
+	for _, name := range names {
+		delete(this.channels, name)
+		delete(this.patterns, name)
+	}
+	this.mutex.Unlock()
+
+	this.resubscribe()
+} // }}}
+
+//在后台开始接收消息
+func (this *Subscriber) Start() { // {{{
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.started {
+		return
+	}
+
+	this.started = true
+	this.done = make(chan struct{})
+	go this.run()
+} // }}}
+
+//停止接收消息, 等待已收到的消息处理完成后返回
+func (this *Subscriber) Stop() { // {{{
+	this.stopOnce.Do(func() {
+		close(this.stop)
+	})
+
+	this.mutex.Lock()
+	if nil != this.conn {
+		this.conn.Close()
+	}
+	done := this.done
+	this.mutex.Unlock()
+
+	if nil != done {
+		<-done
+	}
+} // }}}
+
+//关闭当前连接, 由 run 重新连接并订阅
+func (this *Subscriber) resubscribe() { // {{{
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if nil != this.conn {
+		this.conn.Close()
+		this.conn = nil
+	}
+} // }}}
+
+//连接是否被 resubscribe 主动关闭
+func (this *Subscriber) replaced(conn *redis.Client) bool { // {{{
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return this.conn != conn
+} // }}}
+
+func (this *Subscriber) run() { // {{{
+	queue := make(chan *PubSubMessage, this.QueueSize)
+
+	var wg sync.WaitGroup
+	for i := 0; i < this.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range queue {
+				this.handle(msg)
+			}
+		}()
+	}
+
+	defer func() {
+		close(queue)
+		wg.Wait()
+		close(this.done)
+	}()
+
+	delay := this.MinRetryDelay
+	for {
+		select {
+		case <-this.stop:
+			return
+		default:
+		}
+
+		subscribed, err := this.receive(queue)
+		if nil == err {
+			continue
+		}
+
+		select {
+		case <-this.stop:
+			return
+		default:
+		}
+
+		this.error(err)
+
+		//订阅成功后再断开时重置重连间隔
+		if subscribed {
+			delay = this.MinRetryDelay
+		}
+
+		select {
+		case <-this.stop:
+			return
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > this.MaxRetryDelay {
+			delay = this.MaxRetryDelay
+		}
+	}
+} // }}}
+
+//建立连接并订阅, 持续读取消息直到连接出错, 返回是否成功订阅
+func (this *Subscriber) receive(queue chan *PubSubMessage) (bool, error) { // {{{
+	conn, err := this.rc.Dial()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	conn.ReadTimeout = this.PingInterval
+
+	this.mutex.Lock()
+	select {
+	case <-this.stop:
+		this.mutex.Unlock()
+		return false, nil
+	default:
+	}
+
+	this.conn = conn
+	channels := make([]interface{}, 0, len(this.channels))
+	for ch := range this.channels {
+		channels = append(channels, ch)
+	}
+	patterns := make([]interface{}, 0, len(this.patterns))
+	for p := range this.patterns {
+		patterns = append(patterns, p)
+	}
+	this.mutex.Unlock()
+
+	defer func() {
+		this.mutex.Lock()
+		if this.conn == conn {
+			this.conn = nil
+		}
+		this.mutex.Unlock()
+	}()
+
+	sc := pubsub.NewSubClient(conn)
+	if len(channels) > 0 {
+		if r := sc.Subscribe(channels...); nil != r.Err {
+			return false, r.Err
+		}
+	}
+
+	if len(patterns) > 0 {
+		if r := sc.PSubscribe(patterns...); nil != r.Err {
+			return false, r.Err
+		}
+	}
+
+	for {
+		r := sc.Receive()
+		if r.Timeout() {
+			//没有订阅时 PING 返回普通响应, 同样可用于检测连接
+			if len(channels)+len(patterns) == 0 {
+				if err := conn.Cmd("PING").Err; nil != err {
+					return true, err
+				}
+			} else if p := sc.Ping(); nil != p.Err {
+				return true, p.Err
+			}
+			continue
+		}
+
+		if nil != r.Err {
+			if this.replaced(conn) {
+				return true, nil
+			}
+			return true, r.Err
+		}
+
+		if pubsub.Message == r.Type {
+			queue <- &PubSubMessage{Channel: r.Channel, Pattern: r.Pattern, Message: r.Message}
+		}
+	}
+} // }}}
+
+func (this *Subscriber) handle(msg *PubSubMessage) { // {{{
+	defer func() {
+		if e := recover(); e != nil {
+			this.error(fmt.Errorf("pubsub handler panic: %s %v", msg.Channel, e))
+		}
+	}()
+
+	this.mutex.Lock()
+	var fn PubSubHandler
+	if "" != msg.Pattern {
+		fn = this.patterns[msg.Pattern]
+	} else {
+		fn = this.channels[msg.Channel]
+	}
+	this.mutex.Unlock()
+
+	if nil != fn {
+		fn(msg)
+	}
+} // }}}
+
+func (this *Subscriber) error(err error) { // {{{
+	if nil != this.OnError {
+		this.OnError(err)
+	}
+} // }}}
@@ -1,11 +1,31 @@
 package redis
 
 import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/mediocregopher/radix.v2/cluster"
 	"github.com/mediocregopher/radix.v2/pool"
 	"github.com/mediocregopher/radix.v2/redis"
+	"github.com/mediocregopher/radix.v2/sentinel"
+	"net"
+	"strconv"
+	"strings"
 	"time"
 )
 
+//部署模式
+const (
+	MODE_SINGLE   = "single"   //单机(默认)
+	MODE_CLUSTER  = "cluster"  //Redis Cluster, Host 为逗号分隔的若干节点地址, 只能使用 db 0
+	MODE_SENTINEL = "sentinel" //哨兵, Host 为逗号分隔的哨兵地址, 需设置 MasterName
+)
+
+var ErrClusterUnsupported = errors.New("command not supported in cluster mode")
+
+//cluster 模式下多key命令的key不在同一slot, 可使用 hash tag 使其位于同一slot, 如: {uv}:a, {uv}:b
+var ErrCrossSlot = errors.New("keys in request don't hash to the same slot")
+
 var (
 	DefaultPoolsize     = 10 //连接池最大连接数
 	DefaultTimeout      = 3  //连接超时, 单位:秒
@@ -21,6 +41,7 @@ func NewRedisClient(host, password string, options ...FuncRcOption) (*RedisClien
 		Timeout:      DefaultTimeout,
 		ReadTimeout:  DefaultReadTimeout,
 		WriteTimeout: DefaultWriteTimeout,
+		Codec:        CodecJSON,
 	}
 
 	for _, opt := range options {
@@ -70,15 +91,86 @@ func WithWriteTimeout(timeout int) FuncRcOption { // {{{
 	}
 } // }}}
 
+//NewRedisClient 设置参数 Username, 用于 redis 6 ACL 认证(AUTH username password)
+func WithUsername(username string) FuncRcOption { // {{{
+	return func(rc *RedisClient) {
+		rc.Username = username
+	}
+} // }}}
+
+//NewRedisClient 设置参数 Db, 连接后执行 SELECT
+func WithDb(db int) FuncRcOption { // {{{
+	return func(rc *RedisClient) {
+		if db > 0 {
+			rc.Db = db
+		}
+	}
+} // }}}
+
+//NewRedisClient 设置参数 TLSConfig, 不为nil时使用TLS连接
+func WithTLS(conf *tls.Config) FuncRcOption { // {{{
+	return func(rc *RedisClient) {
+		rc.TLSConfig = conf
+	}
+} // }}}
+
+//NewRedisClient 设置参数 ClientName, 连接后执行 CLIENT SETNAME, 便于在 CLIENT LIST 中识别
+func WithClientName(name string) FuncRcOption { // {{{
+	return func(rc *RedisClient) {
+		rc.ClientName = name
+	}
+} // }}}
+
+//NewRedisClient 设置参数 Prefix, 多个应用共用redis时用于区分key
+func WithPrefix(prefix string) FuncRcOption { // {{{
+	return func(rc *RedisClient) {
+		rc.Prefix = prefix
+	}
+} // }}}
+
+//NewRedisClient 设置参数 Codec, SetValue/GetValue 等使用的编码方式
+func WithCodec(codec Codec) FuncRcOption { // {{{
+	return func(rc *RedisClient) {
+		if nil != codec {
+			rc.Codec = codec
+		}
+	}
+} // }}}
+
+//NewRedisClient 设置参数 Mode, 可选 MODE_SINGLE, MODE_CLUSTER, MODE_SENTINEL, 其他值 Init 时返回错误
+func WithMode(mode string) FuncRcOption { // {{{
+	return func(rc *RedisClient) {
+		rc.Mode = mode
+	}
+} // }}}
+
+//NewRedisClient 设置参数 MasterName, sentinel 模式下监控的 master 名称
+func WithMasterName(name string) FuncRcOption { // {{{
+	return func(rc *RedisClient) {
+		rc.MasterName = name
+	}
+} // }}}
+
 type RedisClient struct {
 	Host         string
 	Password     string
+	Username     string
+	Db           int
+	TLSConfig    *tls.Config
+	ClientName   string
 	Timeout      int //DialTimeout
 	ReadTimeout  int
 	WriteTimeout int
 	Poolsize     int
+	Mode         string
+	MasterName   string
+	Prefix       string //key前缀, 除 Call 及 Pipeline/Tx 的 Cmd, Do 外自动添加
+	Codec        Codec  //SetValue/GetValue 等使用的编码方式, 默认 JSON
 	network      string
 	_pool        *pool.Pool
+	_cluster     *cluster.Cluster
+	_sentinel    *sentinel.Client
+	scripts      scriptRegistry
 }
 
 func (this *RedisClient) Init() error { // {{{
@@ -87,32 +179,44 @@ func (this *RedisClient) Init() error { // {{{
 		this.network = "tcp"
 	}
 
-	_dialfuc := func(network, addr string) (*redis.Client, error) {
-		client, err := redis.DialTimeout(network, addr, time.Second*time.Duration(this.Timeout))
-		if err != nil {
-			return nil, err
+	switch this.Mode {
+	case MODE_CLUSTER:
+		if this.Db > 0 {
+			return errors.New("redis cluster only supports db 0")
 		}
 
-		if "" != this.Password {
-			if err = client.Cmd("AUTH", this.Password).Err; err != nil {
-				client.Close()
-				return nil, err
+		//依次尝试各节点, 任一节点可用即可获取全部slot分布
+		for _, addr := range this.hosts() {
+			this._cluster, err = cluster.NewWithOpts(cluster.Opts{
+				Addr:     addr,
+				PoolSize: this.Poolsize,
+				Dialer:   this.dial,
+			})
+
+			if nil == err {
+				break
 			}
 		}
-
-		if this.ReadTimeout > 0 {
-			client.ReadTimeout = time.Second * time.Duration(this.ReadTimeout)
+	case MODE_SENTINEL:
+		if "" == this.MasterName {
+			return errors.New("redis sentinel master name is empty")
 		}
 
-		if this.WriteTimeout > 0 {
-			client.WriteTimeout = time.Second * time.Duration(this.WriteTimeout)
-		}
+		for _, addr := range this.hosts() {
+			var client *sentinel.Client
+			client, err = sentinel.NewClientCustom(this.network, addr, this.Poolsize, this.dial, this.MasterName)
 
-		return client, nil
+			if nil == err {
+				this._sentinel = client
+				break
+			}
+		}
+	case "", MODE_SINGLE:
+		this._pool, err = pool.NewCustom(this.network, this.Host, this.Poolsize, this.dial)
+	default:
+		return errors.New("unknown redis mode: " + this.Mode)
 	}
 
-	this._pool, err = pool.NewCustom(this.network, this.Host, this.Poolsize, _dialfuc)
-
 	if err != nil {
 		return err
 	}
@@ -122,285 +226,399 @@ func (this *RedisClient) Init() error { // {{{
 
 // }}}
 
-func (this *RedisClient) Set(key string, val interface{}) error { // {{{
-	c, err := this._pool.Get()
+func (this *RedisClient) hosts() []string { // {{{
+	hosts := []string{}
+	for _, h := range strings.Split(this.Host, ",") {
+		if h = strings.TrimSpace(h); "" != h {
+			hosts = append(hosts, h)
+		}
+	}
+
+	return hosts
+} // }}}
+
+//加上前缀的完整key
+func (this *RedisClient) Key(key string) string { // {{{
+	return this.Prefix + key
+} // }}}
+
+func (this *RedisClient) prefixKeys(keys []string) []string { // {{{
+	if "" == this.Prefix {
+		return keys
+	}
+
+	val := make([]string, len(keys))
+	for i, key := range keys {
+		val[i] = this.Prefix + key
+	}
+
+	return val
+} // }}}
+
+func (this *RedisClient) trimPrefix(keys []string) []string { // {{{
+	if "" == this.Prefix {
+		return keys
+	}
+
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, this.Prefix)
+	}
+
+	return keys
+} // }}}
+
+//按部署模式执行命令, cluster 模式下以第一个参数作为key路由到对应节点, sentinel 模式下在当前 master 上执行
+func (this *RedisClient) cmd(cmd string, args ...interface{}) *redis.Resp { // {{{
+	switch this.Mode {
+	case MODE_CLUSTER:
+		return this._cluster.Cmd(cmd, args...)
+	case MODE_SENTINEL:
+		c, err := this._sentinel.GetMaster(this.MasterName)
+		if err != nil {
+			return redis.NewResp(err)
+		}
+		defer this._sentinel.PutMaster(this.MasterName, c)
+
+		return c.Cmd(cmd, args...)
+	}
+
+	return this._pool.Cmd(cmd, args...)
+} // }}}
+
+//新建一个不在连接池中的连接(已认证并选择db), 用于订阅等需要独占连接的场景, 使用后需要 Close
+//sentinel 模式下连接当前 master, cluster 模式下连接第一个节点
+func (this *RedisClient) Dial() (*redis.Client, error) { // {{{
+	if "" == this.network {
+		this.network = "tcp"
+	}
+
+	if MODE_SENTINEL == this.Mode {
+		c, err := this._sentinel.GetMaster(this.MasterName)
+		if err != nil {
+			return nil, err
+		}
+		addr := c.Addr
+		this._sentinel.PutMaster(this.MasterName, c)
+
+		return this.dial(this.network, addr)
+	}
+
+	hosts := this.hosts()
+	if len(hosts) == 0 {
+		return nil, errors.New("redis host is empty")
+	}
+
+	return this.dial(this.network, hosts[0])
+} // }}}
+
+func (this *RedisClient) dial(network, addr string) (*redis.Client, error) { // {{{
+	var client *redis.Client
+	var err error
+
+	timeout := time.Second * time.Duration(this.Timeout)
+	if nil != this.TLSConfig {
+		var conn net.Conn
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: timeout}, network, addr, this.TLSConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		client, err = redis.NewClient(conn)
+	} else {
+		client, err = redis.DialTimeout(network, addr, timeout)
+	}
+
 	if err != nil {
-		return err
+		return nil, err
 	}
-	err = c.Cmd("SET", key, val).Err
-	this._pool.Put(c)
-	return err
+
+	if "" != this.Username {
+		err = client.Cmd("AUTH", this.Username, this.Password).Err
+	} else if "" != this.Password {
+		err = client.Cmd("AUTH", this.Password).Err
+	}
+
+	if nil == err && this.Db > 0 {
+		err = client.Cmd("SELECT", this.Db).Err
+	}
+
+	if nil == err && "" != this.ClientName {
+		err = client.Cmd("CLIENT", "SETNAME", this.ClientName).Err
+	}
+
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	if this.ReadTimeout > 0 {
+		client.ReadTimeout = time.Second * time.Duration(this.ReadTimeout)
+	}
+
+	if this.WriteTimeout > 0 {
+		client.WriteTimeout = time.Second * time.Duration(this.WriteTimeout)
+	}
+
+	return client, nil
+} // }}}
+
+func (this *RedisClient) Set(key string, val interface{}) error { // {{{
+	return this.cmd("SET", this.Key(key), val).Err
 }
 
 // }}}
 
 func (this *RedisClient) Setex(key string, secs int, val interface{}) error { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return err
-	}
-	err = c.Cmd("SETEX", key, secs, val).Err
-	this._pool.Put(c)
-	return err
+	return this.cmd("SETEX", this.Key(key), secs, val).Err
 }
 
 // }}}
 
-func (this *RedisClient) Expire(key string, expire int) error { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return err
+//SET 命令的可选参数
+type SetOption struct {
+	NX      bool //key不存在时才设置
+	XX      bool //key存在时才设置
+	EX      int  //过期时间, 单位:秒
+	PX      int  //过期时间, 单位:毫秒
+	KeepTTL bool //保留原有的过期时间(redis 6.0+)
+}
+
+//带参数的 SET, 因 NX/XX 条件不满足未设置时返回 false
+func (this *RedisClient) SetOpt(key string, val interface{}, opt SetOption) (bool, error) { // {{{
+	args := []interface{}{this.Key(key), val}
+	if opt.EX > 0 {
+		args = append(args, "EX", opt.EX)
+	} else if opt.PX > 0 {
+		args = append(args, "PX", opt.PX)
+	} else if opt.KeepTTL {
+		args = append(args, "KEEPTTL")
 	}
-	err = c.Cmd("EXPIRE", key, expire).Err
-	this._pool.Put(c)
-	return err
+
+	if opt.NX {
+		args = append(args, "NX")
+	} else if opt.XX {
+		args = append(args, "XX")
+	}
+
+	r := this.cmd("SET", args...)
+	if nil != r.Err {
+		return false, r.Err
+	}
+
+	return !r.IsType(redis.Nil), nil
+} // }}}
+
+//key不存在时设置, expire > 0 时同时设置过期时间(秒), 返回是否设置成功
+func (this *RedisClient) SetNx(key string, val interface{}, expire int) (bool, error) { // {{{
+	return this.SetOpt(key, val, SetOption{NX: true, EX: expire})
+} // }}}
+
+//设置新值并返回旧值, key不存在时旧值为空
+func (this *RedisClient) GetSet(key string, val interface{}) (string, error) { // {{{
+	return str(this.cmd("GETSET", this.Key(key), val))
+} // }}}
+
+//获取并删除(redis 6.2+), key不存在时返回空
+func (this *RedisClient) GetDel(key string) (string, error) { // {{{
+	return str(this.cmd("GETDEL", this.Key(key)))
+} // }}}
+
+//按 JSON 编码保存, expire > 0 时设置过期时间(秒)
+func (this *RedisClient) SetJson(key string, v interface{}, expire int) error { // {{{
+	return this.setValue(CodecJSON, key, v, expire)
+} // }}}
+
+//读取 JSON 编码的值并解码到 v, 返回key是否存在
+func (this *RedisClient) GetJson(key string, v interface{}) (bool, error) { // {{{
+	return this.getValue(CodecJSON, key, v)
+} // }}}
+
+func (this *RedisClient) Expire(key string, expire int) error { // {{{
+	return this.cmd("EXPIRE", this.Key(key), expire).Err
 }
 
 // }}}
 
 func (this *RedisClient) Exists(key string) (bool, error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return false, err
-	}
-	val := 0
-	val, err = c.Cmd("Exists", key).Int()
-	this._pool.Put(c)
+	val, _ := this.cmd("Exists", this.Key(key)).Int()
 	return val == 1, nil
 } // }}}
 
 func (this *RedisClient) Ttl(key string) (int, error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return 0, err
-	}
-	val := 0
-	val, err = c.Cmd("Ttl", key).Int()
-	this._pool.Put(c)
+	val, _ := this.cmd("Ttl", this.Key(key)).Int()
 	return val, nil
 } // }}}
 
 func (this *RedisClient) Incr(key string) (val int, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	val, err = c.Cmd("INCR", key).Int()
-	this._pool.Put(c)
+	val, err = this.cmd("INCR", this.Key(key)).Int()
 	return
 } //}}}
 
 func (this *RedisClient) Incrby(key string, increment int) (val int, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	val, err = c.Cmd("INCRBY", key, increment).Int()
-	this._pool.Put(c)
+	val, err = this.cmd("INCRBY", this.Key(key), increment).Int()
 	return
 } //}}}
 
 func (this *RedisClient) IncrbyFloat(key string, increment interface{}) (val float64, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	val, err = c.Cmd("INCRBYFLOAT", key, increment).Float64()
-	this._pool.Put(c)
+	val, err = this.cmd("INCRBYFLOAT", this.Key(key), increment).Float64()
 	return
 } //}}}
 
 func (this *RedisClient) Decr(key string) (val int, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	val, err = c.Cmd("DECR", key).Int()
-	this._pool.Put(c)
+	val, err = this.cmd("DECR", this.Key(key)).Int()
 	return
 } //}}}
 
 func (this *RedisClient) Decrby(key string, increment int) (val int, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	val, err = c.Cmd("DECRBY", key, increment).Int()
-	this._pool.Put(c)
+	val, err = this.cmd("DECRBY", this.Key(key), increment).Int()
 	return
 } //}}}
 
 func (this *RedisClient) Get(key string) (val string, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	val, err = c.Cmd("GET", key).Str()
-	this._pool.Put(c)
+	val, err = this.cmd("GET", this.Key(key)).Str()
 	return
 }
 
 // }}}
 
 func (this *RedisClient) Del(key string) (err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return err
-	}
-	err = c.Cmd("DEL", key).Err
-	this._pool.Put(c)
-	return err
+	return this.cmd("DEL", this.Key(key)).Err
 } // }}}
 
+//cluster 模式下按slot分组删除
 func (this *RedisClient) DelAll(keys []string) (err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return err
+	if MODE_CLUSTER == this.Mode {
+		for _, group := range groupBySlot(this.prefixKeys(keys)) {
+			if err = this.cmd("DEL", group).Err; err != nil {
+				return
+			}
+		}
+
+		return
 	}
-	err = c.Cmd("DEL", keys).Err
-	this._pool.Put(c)
-	return err
+
+	return this.cmd("DEL", this.prefixKeys(keys)).Err
 } // }}}
 
 func (this *RedisClient) ExpireAt(key string, timestamp int) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	_ = c.Cmd("EXPIREAT", key, timestamp).Err
-	this._pool.Put(c)
+	_ = this.cmd("EXPIREAT", this.Key(key), timestamp).Err
 } // }}}
 
+//cluster 模式下在每个 master 上执行并合并结果; 返回的key已去掉前缀
 func (this *RedisClient) Keys(key string) (val []string, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return nil, err
+	if MODE_CLUSTER == this.Mode {
+		val, err = this.clusterKeys(this.Key(key))
+	} else {
+		val, err = this.cmd("KEYS", this.Key(key)).List()
 	}
-	val, err = c.Cmd("KEYS", key).List()
-	this._pool.Put(c)
-	return
+
+	return this.trimPrefix(val), err
 } // }}}
 
+//返回的第一个元素为下次迭代的游标("0" 表示迭代结束), 之后为本次返回的key(已去掉前缀)
+//cluster 模式下各节点游标不通用, 不支持
 func (this *RedisClient) Scan(cursor, pattern, count string) (val []string, err error) { // {{{
-	c, err := this._pool.Get()
+	if MODE_CLUSTER == this.Mode {
+		return nil, ErrClusterUnsupported
+	}
+
+	list, err := this.cmd("SCAN", cursor, "MATCH", this.Key(pattern), "COUNT", count).Array()
 	if err != nil {
 		return nil, err
 	}
-	val, err = c.Cmd("SCAN", cursor, "MATCH", pattern, "COUNT", count).List()
-	this._pool.Put(c)
-	return
+
+	if len(list) < 2 {
+		return nil, errors.New("invalid scan reply")
+	}
+
+	next, err := list[0].Str()
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := list[1].List()
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]string{next}, this.trimPrefix(keys)...), nil
 } // }}}
 
 //list
 func (this *RedisClient) Rpush(key string, val interface{}) error { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return err
-	}
-	err = c.Cmd("Rpush", key, val).Err
-	this._pool.Put(c)
-	return err
+	return this.cmd("Rpush", this.Key(key), val).Err
 }
 
 // }}}
 
 func (this *RedisClient) Lpush(key string, val interface{}) error { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return err
-	}
-	err = c.Cmd("Lpush", key, val).Err
-	this._pool.Put(c)
-	return err
+	return this.cmd("Lpush", this.Key(key), val).Err
 }
 
 // }}}
 
 func (this *RedisClient) Rpop(key string) (val string, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	val, err = c.Cmd("Rpop", key).Str()
-	this._pool.Put(c)
+	val, err = this.cmd("Rpop", this.Key(key)).Str()
 	return
 }
 
 // }}}
 
 func (this *RedisClient) Lpop(key string) (val string, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	val, err = c.Cmd("Lpop", key).Str()
-	this._pool.Put(c)
+	val, err = this.cmd("Lpop", this.Key(key)).Str()
 	return
 }
 
 // }}}
 
+//返回 [key, value], key 已去掉前缀
 func (this *RedisClient) Brpop(key string, timeout int) (val []string, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
+	val, err = this.cmd("BRpop", this.Key(key), timeout).List()
+	if len(val) > 0 {
+		this.trimPrefix(val[:1])
 	}
-	val, err = c.Cmd("BRpop", key, timeout).List()
-	this._pool.Put(c)
+
 	return
 }
 
 // }}}
 
+//返回 [key, value], key 已去掉前缀
 func (this *RedisClient) Blpop(key string, timeout int) (val []string, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
+	val, err = this.cmd("BLpop", this.Key(key), timeout).List()
+	if len(val) > 0 {
+		this.trimPrefix(val[:1])
 	}
-	val, err = c.Cmd("BLpop", key, timeout).List()
-	this._pool.Put(c)
+
 	return
 }
 
 // }}}
 
 func (this *RedisClient) Llen(key string) (val int, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	val, err = c.Cmd("Llen", key).Int()
-	this._pool.Put(c)
+	val, err = this.cmd("Llen", this.Key(key)).Int()
 	return
 }
 
 // }}}
 
 func (this *RedisClient) Lrange(key string, start, stop int) (val []string, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return nil, err
-	}
-
-	val, err = c.Cmd("LRANGE", key, start, stop).List()
+	val, err = this.cmd("LRANGE", this.Key(key), start, stop).List()
 
-	this._pool.Put(c)
 	return
 } // }}}
 
 func (this *RedisClient) Mget(keys []string) (val []string, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
+	if MODE_CLUSTER == this.Mode {
+		return this.clusterMget(this.prefixKeys(keys))
 	}
 
-	r := c.Cmd("MGET", keys)
+	r := this.cmd("MGET", this.prefixKeys(keys))
 	if r.Err != nil {
 		return nil, r.Err
 	}
 
 	val, err = r.List()
-	this._pool.Put(c)
 	return
 }
 
@@ -408,410 +626,429 @@ func (this *RedisClient) Mget(keys []string) (val []string, err error) { // {{{
 
 //hash
 func (this *RedisClient) Hset(key string, field interface{}, val interface{}) error { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return err
-	}
-	err = c.Cmd("HSET", key, field, val).Err
-	this._pool.Put(c)
-	return err
+	return this.cmd("HSET", this.Key(key), field, val).Err
 }
 
 // }}}
 
 func (this *RedisClient) Hsetnx(key string, field interface{}, val interface{}) (err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	err = c.Cmd("HSETNX", key, field, val).Err
-	this._pool.Put(c)
+	err = this.cmd("HSETNX", this.Key(key), field, val).Err
 	return
 }
 
 // }}}
 
 func (this *RedisClient) Hmset(key string, val interface{}) (err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	err = c.Cmd("HMSET", key, val).Err
-	this._pool.Put(c)
+	err = this.cmd("HMSET", this.Key(key), val).Err
 	return
 } // }}}
 
 func (this *RedisClient) Hget(key string, field interface{}) (val string, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	val, err = c.Cmd("HGET", key, field).Str()
-	this._pool.Put(c)
+	val, err = this.cmd("HGET", this.Key(key), field).Str()
 	return
 } // }}}
 
 func (this *RedisClient) Hmget(key string, fields interface{}) (val []string, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	val, err = c.Cmd("HMGET", key, fields).List()
-	this._pool.Put(c)
+	val, err = this.cmd("HMGET", this.Key(key), fields).List()
 	return
 } // }}}
 
 func (this *RedisClient) HgetAll(key string) (val map[string]string, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	val, err = c.Cmd("HGETALL", key).Map()
-	this._pool.Put(c)
+	val, err = this.cmd("HGETALL", this.Key(key)).Map()
 	return
 } // }}}
 
 func (this *RedisClient) Hkeys(key string) (val []string, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	val, err = c.Cmd("HKEYS", key).List()
-	this._pool.Put(c)
+	val, err = this.cmd("HKEYS", this.Key(key)).List()
 	return
 } // }}}
 
-func (this *RedisClient) Hdel(key, field interface{}) error { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return err
-	}
-	err = c.Cmd("HDEL", key, field).Err
-	this._pool.Put(c)
-	return err
+func (this *RedisClient) Hdel(key string, field interface{}) error { // {{{
+	return this.cmd("HDEL", this.Key(key), field).Err
 } // }}}
 
 func (this *RedisClient) HdelAll(key string) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	_ = c.Cmd("DEL", key).Err
-	this._pool.Put(c)
+	_ = this.cmd("DEL", this.Key(key)).Err
 } // }}}
 
 func (this *RedisClient) Hscan(key string, cursor, pattern, count interface{}) (val []string, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return nil, err
-	}
-	val, err = c.Cmd("HSCAN", key, cursor, "MATCH", pattern, "COUNT", count).List()
-	this._pool.Put(c)
+	val, err = this.cmd("HSCAN", this.Key(key), cursor, "MATCH", pattern, "COUNT", count).List()
 	return
 } // }}}
 
 func (this *RedisClient) Hexists(key string) (bool, error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return false, err
-	}
-	val := 0
-	val, err = c.Cmd("HExists", key).Int()
-	this._pool.Put(c)
+	val, _ := this.cmd("HExists", this.Key(key)).Int()
 	return val == 1, nil
 } // }}}
 
 func (this *RedisClient) Hincrby(key string, field interface{}, increment int) (val int, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	val, err = c.Cmd("HINCRBY", key, field, increment).Int()
-	this._pool.Put(c)
+	val, err = this.cmd("HINCRBY", this.Key(key), field, increment).Int()
 	return
 } // }}}
 
 func (this *RedisClient) HincrbyFloat(key string, field interface{}, increment interface{}) (val float64, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	val, err = c.Cmd("HINCRBYFLOAT", key, field, increment).Float64()
-	this._pool.Put(c)
+	val, err = this.cmd("HINCRBYFLOAT", this.Key(key), field, increment).Float64()
 	return
 } // }}}
 
 //zset
-func (this *RedisClient) Zadd(key string, score int, val interface{}) error { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return err
-	}
-	err = c.Cmd("ZADD", key, score, val).Err
-	this._pool.Put(c)
-	return err
+func (this *RedisClient) Zadd(key string, score float64, val interface{}) error { // {{{
+	return this.cmd("ZADD", this.Key(key), score, val).Err
 } // }}}
 
-func (this *RedisClient) Zincrby(key string, increment int, val interface{}) error { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return err
-	}
-	err = c.Cmd("ZINCRBY", key, increment, val).Err
-	this._pool.Put(c)
-	return err
+//返回增加后的score
+func (this *RedisClient) Zincrby(key string, increment float64, val interface{}) (float64, error) { // {{{
+	return this.cmd("ZINCRBY", this.Key(key), increment, val).Float64()
 } // }}}
 
 func (this *RedisClient) Zcard(key string) (val int, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	val, err = c.Cmd("Zcard", key).Int()
-	this._pool.Put(c)
+	val, err = this.cmd("Zcard", this.Key(key)).Int()
 	return
 } // }}}
 
 func (this *RedisClient) Zrank(key string, member interface{}) (val int, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	val, err = c.Cmd("Zrank", key, member).Int()
-	this._pool.Put(c)
+	val, err = this.cmd("Zrank", this.Key(key), member).Int()
 	return
 } // }}}
 
 func (this *RedisClient) Zrevrank(key string, member interface{}) (val int, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
-	}
-	val, err = c.Cmd("Zrevrank", key, member).Int()
-	this._pool.Put(c)
+	val, err = this.cmd("Zrevrank", this.Key(key), member).Int()
 	return
 } // }}}
 
-func (this *RedisClient) Zscore(key string, member interface{}) (val int, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return 0, err
-	}
+func (this *RedisClient) Zscore(key string, member interface{}) (val float64, err error) { // {{{
+	val, err = this.cmd("ZSCORE", this.Key(key), member).Float64()
 
-	val, err = c.Cmd("ZSCORE", key, member).Int()
+	return
+} // }}}
 
-	this._pool.Put(c)
+//score 区间内的成员数, min/max 格式同 ZrangeByScore
+func (this *RedisClient) Zcount(key string, min, max string) (val int, err error) { // {{{
+	val, err = this.cmd("ZCOUNT", this.Key(key), min, max).Int()
 	return
 } // }}}
 
 func (this *RedisClient) Zrange(key string, start, stop int, withscores bool) (val []string, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return nil, err
-	}
 	if withscores {
-		val, err = c.Cmd("ZRANGE", key, start, stop, "WITHSCORES").List()
+		val, err = this.cmd("ZRANGE", this.Key(key), start, stop, "WITHSCORES").List()
 	} else {
-		val, err = c.Cmd("ZRANGE", key, start, stop).List()
+		val, err = this.cmd("ZRANGE", this.Key(key), start, stop).List()
 	}
-	this._pool.Put(c)
 	return
 } // }}}
 
 func (this *RedisClient) Zrevrange(key string, start, stop int, withscores bool) (val []string, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return nil, err
-	}
 	if withscores {
-		val, err = c.Cmd("ZREVRANGE", key, start, stop, "WITHSCORES").List()
+		val, err = this.cmd("ZREVRANGE", this.Key(key), start, stop, "WITHSCORES").List()
 	} else {
-		val, err = c.Cmd("ZREVRANGE", key, start, stop).List()
+		val, err = this.cmd("ZREVRANGE", this.Key(key), start, stop).List()
 	}
-	this._pool.Put(c)
 	return
 } // }}}
 
-func (this *RedisClient) ZrevrangeByScore(key string, start, step int, withscores bool) (val []string, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return nil, err
+//score 区间的边界, exclusive 为 true 时不包含边界值, 如 ScoreBound(5, true) 为 "(5"; 无边界时使用 "-inf", "+inf"
+func ScoreBound(score float64, exclusive bool) string { // {{{
+	b := strconv.FormatFloat(score, 'f', -1, 64)
+	if exclusive {
+		return "(" + b
 	}
 
-	if withscores {
-		val, err = c.Cmd("ZREVRANGEBYSCORE", key, "+inf", "-inf", "WITHSCORES", "LIMIT", start, step).List()
-	} else {
-		val, err = c.Cmd("ZREVRANGEBYSCORE", key, "+inf", "-inf", "LIMIT", start, step).List()
-	}
+	return b
+} // }}}
 
-	this._pool.Put(c)
+//返回有序集 key 中 score 值介于 min 和 max 之间的成员, 按 score 值递增(从小到大)次序排列
+//min/max 如: "1", "(1", "-inf", "+inf", 可通过 ScoreBound 生成; count > 0 时从 offset 开始最多返回 count 个(LIMIT)
+func (this *RedisClient) ZrangeByScore(key string, min, max string, offset, count int, withscores bool) (val []string, err error) { // {{{
+	val, err = this.cmd("ZRANGEBYSCORE", zrangeByScoreArgs(this.Key(key), min, max, offset, count, withscores)...).List()
 	return
 } // }}}
 
-// 返回有序集 key 中，所有 score 值介于 min 和 max 之间(包括等于 min 或 max )的成员。按 score 值递增(从小到大)次序排列。
-func (this *RedisClient) ZrangeByScore(key string, min, max, start, step int, withscores bool) (val []string, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return nil, err
-	}
-	if withscores {
-		val, err = c.Cmd("ZRANGEBYSCORE", key, min, max, "WITHSCORES", "LIMIT", start, step).List()
-	} else {
-		val, err = c.Cmd("ZRANGEBYSCORE", key, min, max, "LIMIT", start, step).List()
-	}
-	this._pool.Put(c)
+//同 ZrangeByScore, 按 score 值递减(从大到小)次序排列, 注意参数顺序为 max, min
+func (this *RedisClient) ZrevrangeByScore(key string, max, min string, offset, count int, withscores bool) (val []string, err error) { // {{{
+	val, err = this.cmd("ZREVRANGEBYSCORE", zrangeByScoreArgs(this.Key(key), max, min, offset, count, withscores)...).List()
 	return
 } // }}}
 
-func (this *RedisClient) ZremrangeByScore(key string, min, max int) (err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return err
+func zrangeByScoreArgs(key string, from, to string, offset, count int, withscores bool) []interface{} { // {{{
+	args := []interface{}{key, from, to}
+	if withscores {
+		args = append(args, "WITHSCORES")
 	}
 
-	err = c.Cmd("ZREMRANGEBYSCORE", key, min, max).Err
+	if count > 0 {
+		args = append(args, "LIMIT", offset, count)
+	}
+
+	return args
+} // }}}
+
+//有序集成员及score
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+//按排名返回成员及score
+func (this *RedisClient) ZrangeWithScores(key string, start, stop int) ([]ZMember, error) { // {{{
+	return zmembers(this.cmd("ZRANGE", this.Key(key), start, stop, "WITHSCORES"))
+} // }}}
+
+func (this *RedisClient) ZrevrangeWithScores(key string, start, stop int) ([]ZMember, error) { // {{{
+	return zmembers(this.cmd("ZREVRANGE", this.Key(key), start, stop, "WITHSCORES"))
+} // }}}
+
+func (this *RedisClient) ZremrangeByScore(key string, min, max string) (err error) { // {{{
+	err = this.cmd("ZREMRANGEBYSCORE", this.Key(key), min, max).Err
 
-	this._pool.Put(c)
 	return err
 } // }}}
 
 func (this *RedisClient) ZrangeBytes(key string, start, stop int, withscores bool) (val [][]byte, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return nil, err
-	}
 	if withscores {
-		val, err = c.Cmd("ZRANGE", key, start, stop, "WITHSCORES").ListBytes()
+		val, err = this.cmd("ZRANGE", this.Key(key), start, stop, "WITHSCORES").ListBytes()
 	} else {
-		val, err = c.Cmd("ZRANGE", key, start, stop).ListBytes()
+		val, err = this.cmd("ZRANGE", this.Key(key), start, stop).ListBytes()
 	}
-	this._pool.Put(c)
 	return
 } // }}}
 
 func (this *RedisClient) ZrevrangeBytes(key string, start, stop int, withscores bool) (val [][]byte, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return nil, err
-	}
 	if withscores {
-		val, err = c.Cmd("ZREVRANGE", key, start, stop, "WITHSCORES").ListBytes()
+		val, err = this.cmd("ZREVRANGE", this.Key(key), start, stop, "WITHSCORES").ListBytes()
 	} else {
-		val, err = c.Cmd("ZREVRANGE", key, start, stop).ListBytes()
+		val, err = this.cmd("ZREVRANGE", this.Key(key), start, stop).ListBytes()
 	}
-	this._pool.Put(c)
 	return
 } // }}}
 
 func (this *RedisClient) Zrem(key string, member interface{}) (val int, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return 0, err
-	}
-
-	val, err = c.Cmd("ZREM", key, member).Int()
+	val, err = this.cmd("ZREM", this.Key(key), member).Int()
 
-	this._pool.Put(c)
 	return
 } // }}}
 
 //sets
 func (this *RedisClient) Sadd(key string, val interface{}) error { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return err
-	}
-	err = c.Cmd("SADD", key, val).Err
-	this._pool.Put(c)
-	return err
+	return this.cmd("SADD", this.Key(key), val).Err
 } // }}}
 
 func (this *RedisClient) SisMember(key string, member interface{}) (bool, error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return false, err
-	}
-	val := 0
-	val, err = c.Cmd("SISMEMBER", key, member).Int()
-	this._pool.Put(c)
+	val, _ := this.cmd("SISMEMBER", this.Key(key), member).Int()
 	return val == 1, nil
 } // }}}
 
 func (this *RedisClient) Srem(key string, member interface{}) (val int, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return 0, err
-	}
+	val, err = this.cmd("SREM", this.Key(key), member).Int()
 
-	val, err = c.Cmd("SREM", key, member).Int()
+	return
+} // }}}
+
+func (this *RedisClient) Spop(key string, count int) (val []string, err error) { // {{{
+	val, err = this.cmd("SPOP", this.Key(key), count).List()
 
-	this._pool.Put(c)
 	return
 } // }}}
 
-func (this *RedisClient) Spop(key, count int) (val []string, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return nil, err
-	}
+func (this *RedisClient) SrandMember(key string, count int) (val []string, err error) { // {{{
+	val, err = this.cmd("SRANDMEMBER", this.Key(key), count).List()
 
-	val, err = c.Cmd("SPOP", key, count).List()
+	return
+} // }}}
+
+func (this *RedisClient) Smembers(key string) (val []string, err error) { // {{{
+	val, err = this.cmd("SMEMBERS", this.Key(key)).List()
+
+	return
+} // }}}
+
+func (this *RedisClient) Scard(key string) (val int, err error) { // {{{
+	val, err = this.cmd("Scard", this.Key(key)).Int()
+	return
+} // }}}
+
+func (this *RedisClient) Sscan(key string, cursor, pattern, count interface{}) (val []string, err error) { // {{{
+	val, err = this.cmd("SSCAN", this.Key(key), cursor, "MATCH", pattern, "COUNT", count).List()
+	return
+} // }}}
+
+//geo
+type GeoLocation struct {
+	Member string
+	Lng    float64
+	Lat    float64
+	Dist   float64 //距中心点的距离, 仅 GeoRadius 返回
+}
 
-	this._pool.Put(c)
+func (this *RedisClient) GeoAdd(key string, lng, lat float64, member interface{}) (val int, err error) { // {{{
+	val, err = this.cmd("GEOADD", this.Key(key), lng, lat, member).Int()
 	return
 } // }}}
 
-func (this *RedisClient) SrandMember(key, count int) (val []string, err error) { // {{{
-	c, err := this._pool.Get()
+//返回成员的经纬度, 成员不存在时对应位置为 nil
+func (this *RedisClient) GeoPos(key string, members ...interface{}) ([]*GeoLocation, error) { // {{{
+	list, err := this.cmd("GEOPOS", this.Key(key), members).Array()
 	if err != nil {
 		return nil, err
 	}
 
-	val, err = c.Cmd("SRANDMEMBER", key, count).List()
+	val := make([]*GeoLocation, len(list))
+	for i, item := range list {
+		if item.IsType(redis.Nil) {
+			continue
+		}
 
-	this._pool.Put(c)
-	return
+		pos, err := item.Array()
+		if err != nil || len(pos) < 2 {
+			continue
+		}
+
+		loc := &GeoLocation{Member: fmt.Sprint(members[i])}
+		loc.Lng, _ = pos[0].Float64()
+		loc.Lat, _ = pos[1].Float64()
+		val[i] = loc
+	}
+
+	return val, nil
 } // }}}
 
-func (this *RedisClient) Smembers(key string) (val []string, err error) { // {{{
-	c, err := this._pool.Get()
+//两个成员间的距离, unit: m, km, mi, ft, 为空时使用 m
+func (this *RedisClient) GeoDist(key string, member1, member2 interface{}, unit string) (float64, error) { // {{{
+	if "" == unit {
+		unit = "m"
+	}
+
+	return this.cmd("GEODIST", this.Key(key), member1, member2, unit).Float64()
+} // }}}
+
+//返回距离指定经纬度 radius 范围内的成员, 按距离由近到远排列, count > 0 时最多返回 count 个
+func (this *RedisClient) GeoRadius(key string, lng, lat, radius float64, unit string, count int) ([]*GeoLocation, error) { // {{{
+	return geoLocations(this.cmd("GEORADIUS", geoRadiusArgs([]interface{}{this.Key(key), lng, lat}, radius, unit, count)...))
+} // }}}
+
+//返回距离指定成员 radius 范围内的成员
+func (this *RedisClient) GeoRadiusByMember(key string, member interface{}, radius float64, unit string, count int) ([]*GeoLocation, error) { // {{{
+	return geoLocations(this.cmd("GEORADIUSBYMEMBER", geoRadiusArgs([]interface{}{this.Key(key), member}, radius, unit, count)...))
+} // }}}
+
+func geoRadiusArgs(args []interface{}, radius float64, unit string, count int) []interface{} { // {{{
+	if "" == unit {
+		unit = "m"
+	}
+
+	args = append(args, radius, unit, "WITHCOORD", "WITHDIST", "ASC")
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+
+	return args
+} // }}}
+
+//[[member, dist, [lng, lat]], ...]
+func geoLocations(r *redis.Resp) ([]*GeoLocation, error) { // {{{
+	list, err := r.Array()
 	if err != nil {
 		return nil, err
 	}
 
-	val, err = c.Cmd("SMEMBERS", key).List()
+	val := make([]*GeoLocation, 0, len(list))
+	for _, item := range list {
+		fields, err := item.Array()
+		if err != nil || len(fields) < 3 {
+			continue
+		}
+
+		loc := &GeoLocation{}
+		loc.Member, _ = fields[0].Str()
+		loc.Dist, _ = fields[1].Float64()
+		if pos, err := fields[2].Array(); nil == err && len(pos) >= 2 {
+			loc.Lng, _ = pos[0].Float64()
+			loc.Lat, _ = pos[1].Float64()
+		}
 
-	this._pool.Put(c)
+		val = append(val, loc)
+	}
+
+	return val, nil
+} // }}}
+
+//hyperloglog
+//返回基数估计值是否发生变化
+func (this *RedisClient) Pfadd(key string, vals ...interface{}) (bool, error) { // {{{
+	val, err := this.cmd("PFADD", this.Key(key), vals).Int()
+	return val == 1, err
+} // }}}
+
+//多个key时返回并集的基数估计值; cluster 模式下并集无法按slot合并, key 不在同一slot时返回 ErrCrossSlot
+func (this *RedisClient) Pfcount(keys ...string) (val int, err error) { // {{{
+	keys = this.prefixKeys(keys)
+	if MODE_CLUSTER == this.Mode && !sameSlot(keys) {
+		return 0, ErrCrossSlot
+	}
+
+	val, err = this.cmd("PFCOUNT", keys).Int()
 	return
 } // }}}
 
-func (this *RedisClient) Scard(key string) (val int, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return
+//cluster 模式下 dest 与 keys 需在同一slot, 否则返回 ErrCrossSlot
+func (this *RedisClient) Pfmerge(dest string, keys ...string) error { // {{{
+	keys = append([]string{this.Key(dest)}, this.prefixKeys(keys)...)
+	if MODE_CLUSTER == this.Mode && !sameSlot(keys) {
+		return ErrCrossSlot
 	}
-	val, err = c.Cmd("Scard", key).Int()
-	this._pool.Put(c)
+
+	return this.cmd("PFMERGE", keys).Err
+} // }}}
+
+//bitmap
+//设置 offset 位的值(0或1), 返回原来的值
+func (this *RedisClient) Setbit(key string, offset, bit int) (val int, err error) { // {{{
+	val, err = this.cmd("SETBIT", this.Key(key), offset, bit).Int()
 	return
 } // }}}
 
-func (this *RedisClient) Sscan(key string, cursor, pattern, count interface{}) (val []string, err error) { // {{{
-	c, err := this._pool.Get()
-	if err != nil {
-		return nil, err
+func (this *RedisClient) Getbit(key string, offset int) (val int, err error) { // {{{
+	val, err = this.cmd("GETBIT", this.Key(key), offset).Int()
+	return
+} // }}}
+
+//值为1的位数, 可选参数 start, end 为字节范围
+func (this *RedisClient) Bitcount(key string, start_end ...int) (val int, err error) { // {{{
+	args := []interface{}{this.Key(key)}
+	if len(start_end) >= 2 {
+		args = append(args, start_end[0], start_end[1])
 	}
-	val, err = c.Cmd("SSCAN", key, cursor, "MATCH", pattern, "COUNT", count).List()
-	this._pool.Put(c)
+
+	val, err = this.cmd("BITCOUNT", args...).Int()
 	return
 } // }}}
 
-//__call 魔术方法
+//__call 魔术方法, 参数原样发送, 不添加key前缀, 需要时通过 Key 获取完整的key
 func (this *RedisClient) Call(cmd string, args ...interface{}) (resp *redis.Resp, err error) { // {{{
-	c, err := this._pool.Get()
+	resp = this.cmd(cmd, args...)
+	return
+} // }}}
+
+//key不存在(nil)时返回空字符串
+func str(r *redis.Resp) (string, error) { // {{{
+	if r.IsType(redis.Nil) {
+		return "", nil
+	}
+
+	return r.Str()
+} // }}}
+
+//[member, score, member, score, ...]
+func zmembers(r *redis.Resp) ([]ZMember, error) { // {{{
+	list, err := r.List()
 	if err != nil {
-		return
+		return nil, err
 	}
-	resp = c.Cmd(cmd, args...)
-	this._pool.Put(c)
-	return
+
+	val := make([]ZMember, 0, len(list)/2)
+	for i := 0; i+1 < len(list); i += 2 {
+		score, _ := strconv.ParseFloat(list[i+1], 64)
+		val = append(val, ZMember{Member: list[i], Score: score})
+	}
+
+	return val, nil
 } // }}}
@@ -0,0 +1,122 @@
+package redis
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"github.com/mediocregopher/radix.v2/redis"
+	"strings"
+	"sync"
+)
+
+//框架内置脚本
+var (
+	//原子地自增并在首次创建(或没有过期时间)时设置过期时间, KEYS[1]: key, ARGV[1]: 增量, ARGV[2]: 过期时间(秒), 返回自增后的值
+	ScriptIncrExpire = NewScript(`
+local n = redis.call('INCRBY', KEYS[1], ARGV[1])
+if tonumber(n) == tonumber(ARGV[1]) or redis.call('TTL', KEYS[1]) == -1 then
+	redis.call('EXPIRE', KEYS[1], ARGV[2])
+end
+return n`)
+
+	//值与 ARGV[1] 相等时删除 KEYS[1], 返回删除的数量
+	ScriptCompareDel = NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+
+	//值与 ARGV[1] 相等时将 KEYS[1] 的过期时间设为 ARGV[2] 毫秒, 返回是否设置成功
+	ScriptComparePexpire = NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`)
+
+	ErrScriptNotFound = errors.New("redis script not registered")
+)
+
+//Lua 脚本, 通过 EVALSHA 执行, 服务端未缓存(NOSCRIPT)时自动改用 EVAL 执行并缓存
+func NewScript(src string) *Script { // {{{
+	h := sha1.Sum([]byte(src))
+
+	return &Script{
+		Src: src,
+		Sha: hex.EncodeToString(h[:]),
+	}
+} // }}}
+
+type Script struct {
+	Src string
+	Sha string
+}
+
+type scriptRegistry struct {
+	mutex   sync.RWMutex
+	scripts map[string]*Script
+}
+
+//按名称注册脚本, 之后通过 RunScript 调用, 重复注册时覆盖
+func (this *RedisClient) RegisterScript(name, src string) *Script { // {{{
+	s := NewScript(src)
+
+	this.scripts.mutex.Lock()
+	defer this.scripts.mutex.Unlock()
+
+	if nil == this.scripts.scripts {
+		this.scripts.scripts = map[string]*Script{}
+	}
+	this.scripts.scripts[name] = s
+
+	return s
+} // }}}
+
+//按名称执行已注册的脚本
+func (this *RedisClient) RunScript(name string, keys []string, args ...interface{}) *Result { // {{{
+	this.scripts.mutex.RLock()
+	s := this.scripts.scripts[name]
+	this.scripts.mutex.RUnlock()
+
+	if nil == s {
+		return &Result{resp: redis.NewResp(ErrScriptNotFound)}
+	}
+
+	return this.Eval(s, keys, args...)
+} // }}}
+
+//执行脚本, cluster 模式下在第一个key所在节点执行, 所有key须在同一slot
+func (this *RedisClient) Eval(s *Script, keys []string, args ...interface{}) *Result { // {{{
+	keys = this.prefixKeys(keys)
+	key := ""
+	if len(keys) > 0 {
+		key = keys[0]
+	}
+
+	c, err := this.getConn(key)
+	if err != nil {
+		return &Result{resp: redis.NewResp(err)}
+	}
+	defer this.putConn(c)
+
+	r := c.Cmd("EVALSHA", s.Sha, len(keys), keys, args)
+	if nil != r.Err && strings.HasPrefix(r.Err.Error(), "NOSCRIPT") {
+		r = c.Cmd("EVAL", s.Src, len(keys), keys, args)
+	}
+
+	return &Result{resp: r}
+} // }}}
+
+//原子地自增并设置过期时间(仅在key新建或没有过期时间时设置)
+func (this *RedisClient) IncrExpire(key string, increment, expire int) (int, error) { // {{{
+	return this.Eval(ScriptIncrExpire, []string{key}, increment, expire).Int()
+} // }}}
+
+//key的值与val相等时删除, 返回是否删除
+func (this *RedisClient) CompareAndDelete(key string, val interface{}) (bool, error) { // {{{
+	return this.Eval(ScriptCompareDel, []string{key}, val).Bool()
+} // }}}
+
+//key的值与val相等时设置过期时间(毫秒), 返回是否设置成功
+func (this *RedisClient) CompareAndPexpire(key string, val interface{}, ms int) (bool, error) { // {{{
+	return this.Eval(ScriptComparePexpire, []string{key}, val, ms).Bool()
+} // }}}
@@ -0,0 +1,221 @@
+package redis
+
+import (
+	"github.com/mediocregopher/radix.v2/redis"
+	"strings"
+	"time"
+)
+
+//stream 中的一条消息
+type StreamMessage struct {
+	Id         string
+	Values     map[string]string
+	Deliveries int //被投递的次数, 仅 StreamWorker 处理时有值
+}
+
+//消费组中已读取未确认的消息
+type StreamPending struct {
+	Id         string
+	Consumer   string
+	Idle       time.Duration //距上次投递的时间
+	Deliveries int           //被投递的次数
+}
+
+//cluster 模式下 XREAD 等命令的第一个参数不是key, 需按指定的key选择节点
+func (this *RedisClient) cmdForKey(key string, cmd string, args ...interface{}) *redis.Resp { // {{{
+	if MODE_CLUSTER != this.Mode {
+		return this.cmd(cmd, args...)
+	}
+
+	c, err := this.getConn(key)
+	if err != nil {
+		return redis.NewResp(err)
+	}
+	defer this.putConn(c)
+
+	return c.Cmd(cmd, args...)
+} // }}}
+
+//添加消息, values 为 map 或 [field, value, ...] 形式的列表; maxlen > 0 时按近似长度裁剪(MAXLEN ~), 返回消息id
+func (this *RedisClient) Xadd(key string, values interface{}, maxlen ...int) (string, error) { // {{{
+	args := []interface{}{this.Key(key)}
+	if len(maxlen) > 0 && maxlen[0] > 0 {
+		args = append(args, "MAXLEN", "~", maxlen[0])
+	}
+	args = append(args, "*", values)
+
+	return this.cmd("XADD", args...).Str()
+} // }}}
+
+func (this *RedisClient) Xlen(key string) (int, error) { // {{{
+	return this.cmd("XLEN", this.Key(key)).Int()
+} // }}}
+
+func (this *RedisClient) Xdel(key string, ids ...string) (int, error) { // {{{
+	return this.cmd("XDEL", this.Key(key), ids).Int()
+} // }}}
+
+//按id范围读取, start/end 可使用 "-" 和 "+", count <= 0 时不限制数量
+func (this *RedisClient) Xrange(key, start, end string, count int) ([]*StreamMessage, error) { // {{{
+	args := []interface{}{this.Key(key), start, end}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+
+	return parseStreamEntries(this.cmd("XRANGE", args...))
+} // }}}
+
+//读取id之后的消息, id 为 "$" 时只读取新消息; block > 0 时最多阻塞等待 block 时长, 超时返回空列表
+func (this *RedisClient) Xread(key, id string, count int, block time.Duration) ([]*StreamMessage, error) { // {{{
+	key = this.Key(key)
+	args := streamReadArgs(count, block)
+	args = append(args, "STREAMS", key, id)
+
+	return parseStreamRead(this.cmdForKey(key, "XREAD", args...))
+} // }}}
+
+//创建消费组, id 为 "$" 时只消费新消息, "0" 时消费全部消息; mkstream 为 true 时 stream 不存在则自动创建; 消费组已存在时不报错
+func (this *RedisClient) XgroupCreate(key, group, id string, mkstream bool) error { // {{{
+	key = this.Key(key)
+	args := []interface{}{"CREATE", key, group, id}
+	if mkstream {
+		args = append(args, "MKSTREAM")
+	}
+
+	err := this.cmdForKey(key, "XGROUP", args...).Err
+	if nil != err && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+
+	return err
+} // }}}
+
+func (this *RedisClient) XgroupDestroy(key, group string) error { // {{{
+	key = this.Key(key)
+	return this.cmdForKey(key, "XGROUP", "DESTROY", key, group).Err
+} // }}}
+
+//以消费组方式读取, id 为 ">" 时读取未投递过的新消息, 为 "0" 时读取本消费者已读取未确认的消息
+func (this *RedisClient) XreadGroup(key, group, consumer, id string, count int, block time.Duration) ([]*StreamMessage, error) { // {{{
+	key = this.Key(key)
+	args := []interface{}{"GROUP", group, consumer}
+	args = append(args, streamReadArgs(count, block)...)
+	args = append(args, "STREAMS", key, id)
+
+	return parseStreamRead(this.cmdForKey(key, "XREADGROUP", args...))
+} // }}}
+
+//确认消息已处理, 返回确认的数量
+func (this *RedisClient) Xack(key, group string, ids ...string) (int, error) { // {{{
+	return this.cmd("XACK", this.Key(key), group, ids).Int()
+} // }}}
+
+//读取消费组中已读取未确认的消息, start/end 可使用 "-" 和 "+"
+func (this *RedisClient) Xpending(key, group, start, end string, count int) ([]*StreamPending, error) { // {{{
+	list, err := this.cmd("XPENDING", this.Key(key), group, start, end, count).Array()
+	if err != nil {
+		return nil, err
+	}
+
+	val := make([]*StreamPending, 0, len(list))
+	for _, item := range list {
+		fields, err := item.Array()
+		if err != nil || len(fields) < 4 {
+			continue
+		}
+
+		p := &StreamPending{}
+		p.Id, _ = fields[0].Str()
+		p.Consumer, _ = fields[1].Str()
+		idle, _ := fields[2].Int64()
+		p.Idle = time.Duration(idle) * time.Millisecond
+		p.Deliveries, _ = fields[3].Int()
+
+		val = append(val, p)
+	}
+
+	return val, nil
+} // }}}
+
+//将空闲时间超过 min_idle 的消息转移给 consumer, 返回转移成功的消息(已被删除的消息不返回)
+func (this *RedisClient) Xclaim(key, group, consumer string, min_idle time.Duration, ids ...string) ([]*StreamMessage, error) { // {{{
+	return parseStreamEntries(this.cmd("XCLAIM", this.Key(key), group, consumer, int64(min_idle/time.Millisecond), ids))
+} // }}}
+
+func streamReadArgs(count int, block time.Duration) []interface{} { // {{{
+	args := []interface{}{}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+
+	if block > 0 {
+		args = append(args, "BLOCK", int64(block/time.Millisecond))
+	}
+
+	return args
+} // }}}
+
+//XREAD/XREADGROUP 返回: [[stream, [[id, [field, value, ...]], ...]], ...], 超时返回 nil
+func parseStreamRead(r *redis.Resp) ([]*StreamMessage, error) { // {{{
+	if nil != r.Err {
+		return nil, r.Err
+	}
+
+	if r.IsType(redis.Nil) {
+		return []*StreamMessage{}, nil
+	}
+
+	streams, err := r.Array()
+	if err != nil {
+		return nil, err
+	}
+
+	val := []*StreamMessage{}
+	for _, s := range streams {
+		item, err := s.Array()
+		if err != nil || len(item) < 2 {
+			continue
+		}
+
+		list, err := parseStreamEntries(item[1])
+		if err != nil {
+			return nil, err
+		}
+
+		val = append(val, list...)
+	}
+
+	return val, nil
+} // }}}
+
+//[[id, [field, value, ...]], ...], 已删除的消息 field 列表为 nil, XCLAIM 中已删除的消息为 nil
+func parseStreamEntries(r *redis.Resp) ([]*StreamMessage, error) { // {{{
+	list, err := r.Array()
+	if err != nil {
+		return nil, err
+	}
+
+	val := make([]*StreamMessage, 0, len(list))
+	for _, entry := range list {
+		if entry.IsType(redis.Nil) {
+			continue
+		}
+
+		item, err := entry.Array()
+		if err != nil || len(item) < 2 {
+			continue
+		}
+
+		m := &StreamMessage{Values: map[string]string{}}
+		m.Id, _ = item[0].Str()
+		if !item[1].IsType(redis.Nil) {
+			if values, err := item[1].Map(); nil == err {
+				m.Values = values
+			}
+		}
+
+		val = append(val, m)
+	}
+
+	return val, nil
+} // }}}
@@ -148,6 +148,7 @@ func (this *Ygo) Run() {
 
 func (this *Ygo) run(modes ...string) { // {{{
 	defer func() {
+		x.Shutdown()
 		this.removePidFile()
 		fmt.Println("======= Server Exit ======")
 	}()
@@ -221,6 +222,13 @@ func (this *Ygo) run(modes ...string) { // {{{
 
 	} // }}}
 
+	for _, mode := range modes {
+		if SERVER_CLI != mode {
+			x.AutoSaveLocalCache(x.LocalCache)
+			break
+		}
+	}
+
 	monitor_port := x.Conf.Get("monitor_port")
 	if "" != monitor_port && run_moniter {
 		go x.RunMonitor(monitor_port)